@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/AtoyanMikhail/auth/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+const configUsage = `usage: auth config <command> [flags]
+
+commands:
+  env       print every supported environment variable
+  validate  validate the effective config and list every violation
+  print     print the effective config with secrets redacted and the source of every value`
+
+// runConfigCommand runs "auth config <command>" and returns the exit code
+func runConfigCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, configUsage)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("config "+args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	switch args[0] {
+	case "env":
+		if fs.Parse(args[1:]) != nil {
+			return 2
+		}
+		printEnvVars(stdout)
+		return 0
+	case "validate":
+		flags := config.BindFlags(fs)
+		if fs.Parse(args[1:]) != nil {
+			return 2
+		}
+		return validateConfig(stdout, stderr, flags)
+	case "print":
+		flags := config.BindFlags(fs)
+		format := fs.String("format", "json", "output format: json or yaml")
+		if fs.Parse(args[1:]) != nil {
+			return 2
+		}
+		return printConfig(stdout, stderr, flags, *format)
+	default:
+		fmt.Fprintf(stderr, "unknown config command %q\n%s\n", args[0], configUsage)
+		return 2
+	}
+}
+
+// printEnvVars prints a table of the environment variables supported by the config
+func printEnvVars(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTYPE\tDEFAULT\tSECRET\tPATH")
+	for _, v := range config.EnvVars() {
+		secret := "no"
+		if v.Secret {
+			secret = "yes, or " + v.Name + config.FileEnvSuffix
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%q\t%s\t%s\n", v.Name, v.Type, v.Default, secret, v.Path)
+	}
+	tw.Flush()
+}
+
+// validateConfig loads the effective config and reports whether it is valid
+func validateConfig(stdout, stderr io.Writer, flags *config.Flags) int {
+	if _, err := config.NewLoader(config.DefaultSources(flags)...).Load(); err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		return 1
+	}
+
+	fmt.Fprintln(stdout, "config is valid")
+	return 0
+}
+
+// printConfig prints the effective config annotated with the source of every value. An invalid config is printed
+// as well, its violations are reported to stderr.
+func printConfig(stdout, stderr io.Writer, flags *config.Flags, format string) int {
+	cfg, origins, loadErr := config.NewLoader(config.DefaultSources(flags)...).LoadWithOrigins()
+
+	annotated := config.Annotated(cfg, origins)
+
+	var err error
+	switch format {
+	case "json":
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(annotated)
+	case "yaml":
+		enc := yaml.NewEncoder(stdout)
+		enc.SetIndent(2)
+		err = enc.Encode(annotated)
+	default:
+		err = fmt.Errorf("unknown format %q: expected json or yaml", format)
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err.Error())
+		return 1
+	}
+
+	if loadErr != nil {
+		fmt.Fprintln(stderr, loadErr.Error())
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AtoyanMikhail/auth/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const validConfig = `
+database:
+  dsn: postgres://auth:db-secret@db/auth?sslmode=disable
+jwt:
+  secret_key: jwt-secret
+token_hash:
+  pepper: pepper-secret
+`
+
+// writeConfig writes a config file and returns its path
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestRunConfigCommand(t *testing.T) {
+	valid := writeConfig(t, validConfig)
+	invalid := writeConfig(t, "server:\n  port: not-a-port\n")
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStdout []string
+		wantStderr []string
+	}{
+		{
+			name:       "no command",
+			wantCode:   2,
+			wantStderr: []string{"usage: auth config <command>"},
+		},
+		{
+			name:       "unknown command",
+			args:       []string{"show"},
+			wantCode:   2,
+			wantStderr: []string{`unknown config command "show"`},
+		},
+		{
+			name:       "unknown flag",
+			args:       []string{"validate", "--verbose"},
+			wantCode:   2,
+			wantStderr: []string{"flag provided but not defined: -verbose"},
+		},
+		{
+			name:       "env",
+			args:       []string{"env"},
+			wantStdout: []string{"NAME", "DB_DSN", "yes, or DB_DSN" + config.FileEnvSuffix, "database.dsn"},
+		},
+		{
+			name:       "validate a valid config",
+			args:       []string{"validate", "--config", valid},
+			wantStdout: []string{"config is valid"},
+		},
+		{
+			name:       "validate an invalid config",
+			args:       []string{"validate", "--config", invalid},
+			wantCode:   1,
+			wantStderr: []string{"config validation failed", "server.port: failed on the 'numeric' rule"},
+		},
+		{
+			name:       "print",
+			args:       []string{"print", "--config", valid, "--set", "server.port=9090"},
+			wantStdout: []string{`"value": "9090"`, `"source": "flag"`, "redacted"},
+		},
+		{
+			name:       "print an invalid config",
+			args:       []string{"print", "--config", invalid},
+			wantCode:   1,
+			wantStdout: []string{`"value": "not-a-port"`, `"source": "file"`},
+			wantStderr: []string{"server.port: failed on the 'numeric' rule"},
+		},
+		{
+			name:       "print in an unknown format",
+			args:       []string{"print", "--config", valid, "--format", "xml"},
+			wantCode:   1,
+			wantStderr: []string{`unknown format "xml"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := runConfigCommand(tt.args, &stdout, &stderr)
+
+			assert.Equal(t, tt.wantCode, code, stderr.String())
+			for _, want := range tt.wantStdout {
+				assert.Contains(t, stdout.String(), want)
+			}
+			for _, want := range tt.wantStderr {
+				assert.Contains(t, stderr.String(), want)
+			}
+			if len(tt.wantStderr) == 0 {
+				assert.Empty(t, stderr.String())
+			}
+			for _, secret := range []string{"db-secret", "jwt-secret", "pepper-secret"} {
+				assert.NotContains(t, stdout.String()+stderr.String(), secret)
+			}
+		})
+	}
+}
+
+func TestPrintConfig(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", "env-secret-key")
+	flags := &config.Flags{
+		ConfigPath: writeConfig(t, validConfig),
+		Overrides:  config.Overrides{"server.host": "127.0.0.1"},
+	}
+
+	tests := []struct {
+		format    string
+		unmarshal func(data []byte, v any) error
+	}{
+		{format: "json", unmarshal: json.Unmarshal},
+		{format: "yaml", unmarshal: yaml.Unmarshal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			require.Equal(t, 0, printConfig(&stdout, &stderr, flags, tt.format), stderr.String())
+			for _, secret := range []string{"db-secret", "env-secret-key", "pepper-secret"} {
+				assert.NotContains(t, stdout.String(), secret)
+			}
+
+			var printed struct {
+				Database  map[string]config.AnnotatedValue `json:"database" yaml:"database"`
+				JWT       map[string]config.AnnotatedValue `json:"jwt" yaml:"jwt"`
+				Server    map[string]config.AnnotatedValue `json:"server" yaml:"server"`
+				TokenHash map[string]config.AnnotatedValue `json:"token_hash" yaml:"token_hash"`
+			}
+			require.NoError(t, tt.unmarshal(stdout.Bytes(), &printed))
+
+			assert.Equal(t, config.AnnotatedValue{Value: config.RedactedValue, Source: "env"}, printed.JWT["secret_key"])
+			assert.Equal(t, config.AnnotatedValue{Value: config.RedactedValue, Source: "file"}, printed.Database["dsn"])
+			assert.Equal(t, config.AnnotatedValue{Value: config.RedactedValue, Source: "file"}, printed.TokenHash["pepper"])
+			assert.Equal(t, config.AnnotatedValue{Value: "127.0.0.1", Source: "flag"}, printed.Server["host"])
+			assert.Equal(t, config.AnnotatedValue{Value: "15m0s", Source: "default"}, printed.JWT["access_token_ttl"])
+		})
+	}
+}
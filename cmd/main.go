@@ -1,16 +1,161 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"flag"
+	"io"
 	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/AtoyanMikhail/auth/internal/admin"
+	"github.com/AtoyanMikhail/auth/internal/app"
+	"github.com/AtoyanMikhail/auth/internal/cache"
+	"github.com/AtoyanMikhail/auth/internal/cleanup"
 	"github.com/AtoyanMikhail/auth/internal/config"
+	"github.com/AtoyanMikhail/auth/internal/config/reload"
+	"github.com/AtoyanMikhail/auth/internal/health"
+	"github.com/AtoyanMikhail/auth/internal/logger"
+	"github.com/AtoyanMikhail/auth/internal/repository"
+	"github.com/AtoyanMikhail/auth/internal/service"
+	"github.com/AtoyanMikhail/auth/internal/tokenhash"
+	"github.com/AtoyanMikhail/auth/internal/tracing"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfigCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	flags := config.BindFlags(flag.CommandLine)
+	flag.Parse()
+
 	cfg, err := config.GetConfig()
 	if err != nil {
 		log.Fatal(err.Error())
 	}
-	fmt.Println(cfg)
+
+	if err := logger.InitializeFromConfig(cfg.Log); err != nil {
+		log.Fatal(err.Error())
+	}
+	l := logger.Global()
+	// Libraries logging with slog write to the same stream
+	slog.SetDefault(slog.New(logger.NewSlogHandler(l)))
+
+	l.Info("Config loaded",
+		logger.String("environment", string(cfg.Environment)),
+		logger.String("path", config.ResolveConfigPath(flags)))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// A second signal kills the process without waiting for the shutdown
+		<-ctx.Done()
+		stop()
+	}()
+
+	a := app.New(l, time.Duration(cfg.Server.ShutdownTimeout))
+	// Added first, so that the log files are closed after every other resource
+	if files, ok := l.(io.Closer); ok {
+		a.OnClose("log files", files.Close)
+	}
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		l.Fatal("Failed to set up tracing", logger.Error(err))
+	}
+	// Closers run in reverse order: traces are flushed after the connections are closed, so that the spans
+	// of the shutdown are exported too
+	a.OnClose("tracing", func() error {
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		return shutdownTracing(flushCtx)
+	})
+
+	repo, err := repository.NewRefreshTokenRepository(ctx, cfg.Database, l)
+	if err != nil {
+		l.Fatal("Failed to connect to Postgres", logger.Error(err))
+	}
+	a.OnClose("postgres", repo.Close)
+	if err := repo.RunMigrations(cfg.Database.MigrationsPath); err != nil {
+		l.Fatal("Failed to run migrations", logger.Error(err))
+	}
+
+	hasher, err := tokenhash.New(cfg.TokenHash)
+	if err != nil {
+		l.Fatal("Failed to create the token hasher", logger.Error(err))
+	}
+
+	redisCache, err := cache.NewRedisCache(cfg.Redis, l)
+	if err != nil {
+		l.Fatal("Failed to connect to Redis", logger.Error(err))
+	}
+	a.OnClose("redis", redisCache.Close)
+
+	checker := health.NewChecker(2 * time.Second)
+	checker.Add("postgres", repo.Ping)
+	checker.Add("redis", redisCache.Ping)
+	checker.Add("migrations", func(ctx context.Context) error {
+		return repo.CheckMigrations(ctx, cfg.Database.MigrationsPath)
+	})
+
+	reloader := reload.New(config.NewLoader(config.DefaultSources(flags)...), cfg, config.ResolveConfigPath(flags), l)
+	reloader.OnReload(reload.SetLogLevel(l))
+	a.Go("config reloader", reloader.Run)
+
+	// Issues, refreshes and revokes the refresh tokens of the token endpoints of api/openapi.yaml,
+	// whose handlers are not implemented yet. The token TTL is read from the reloaded config.
+	_ = service.NewRefreshTokenService(repo, hasher, func() config.JWTConfig { return reloader.Current().JWT }, l)
+
+	if cfg.Cleanup.Enabled {
+		a.Go("token cleanup", cleanup.New(repo, cfg.Cleanup, l).Run)
+	}
+
+	levels := admin.NewLogLevelHandler(l)
+	a.Go("log level signals", func(ctx context.Context) error {
+		admin.HandleLevelSignals(ctx, levels, time.Duration(cfg.Admin.DebugDuration))
+		return nil
+	})
+
+	server := &http.Server{
+		Addr:         net.JoinHostPort(cfg.Server.Host, cfg.Server.Port),
+		Handler:      newRouter(cfg, l, levels, checker),
+		ReadTimeout:  time.Duration(cfg.Server.ReadTimeout),
+		WriteTimeout: time.Duration(cfg.Server.WriteTimeout),
+	}
+	a.Go("http server", func(ctx context.Context) error {
+		l.Info("HTTP server started", logger.String("addr", server.Addr))
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	})
+
+	// Readiness goes down first, then the server stops accepting connections and drains the requests in flight.
+	// Webhook workers and their outbox would be flushed by hooks added after the server's, once they exist.
+	a.OnShutdown("readiness", func(ctx context.Context) error {
+		checker.Shutdown()
+		select {
+		case <-time.After(time.Duration(cfg.Server.ShutdownDelay)):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	a.OnShutdown("http server", server.Shutdown)
+
+	err = a.Run(ctx)
+	if err != nil {
+		l.Error("Shutdown with errors", logger.Error(err))
+	}
+	_ = l.Sync()
+	if err != nil {
+		os.Exit(1)
+	}
 }
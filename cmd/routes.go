@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/AtoyanMikhail/auth/internal/admin"
+	"github.com/AtoyanMikhail/auth/internal/config"
+	"github.com/AtoyanMikhail/auth/internal/health"
+	"github.com/AtoyanMikhail/auth/internal/logger"
+	"github.com/AtoyanMikhail/auth/internal/metrics"
+	"github.com/AtoyanMikhail/auth/internal/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// newRouter registers the HTTP endpoints of the service
+func newRouter(cfg *config.Config, l logger.Logger, levels *admin.LogLevelHandler, checker *health.Checker) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+
+	requireAdmin := admin.RequireToken(cfg.Admin.Token)
+	mux.Handle("/admin/log-level", requireAdmin(levels))
+
+	// Probes are served outside of the tracing and request ID middlewares, as they would flood traces and logs
+	root := http.NewServeMux()
+	root.Handle("/healthz", checker.LivenessHandler())
+	root.Handle("/readyz", checker.ReadinessHandler())
+	// The span is started first, so that the logger of the request gets its trace ID
+	root.Handle("/", otelhttp.NewHandler(middleware.RequestID(l)(mux), "http.server"))
+
+	return root
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AtoyanMikhail/auth/internal/admin"
+	"github.com/AtoyanMikhail/auth/internal/config"
+	"github.com/AtoyanMikhail/auth/internal/health"
+	"github.com/AtoyanMikhail/auth/internal/logger"
+	"github.com/AtoyanMikhail/auth/internal/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewRouter_Tracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	l, err := logger.NewWithSinks(logger.Sink{Name: "test", Writer: &bytes.Buffer{}, Level: logger.InfoLevel})
+	require.NoError(t, err)
+	cfg := &config.Config{Admin: config.AdminConfig{Token: "admin"}}
+	router := newRouter(cfg, l, admin.NewLogLevelHandler(l), health.NewChecker(time.Second))
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+		wantSpan   bool
+	}{
+		{name: "routed request", path: "/metrics", wantStatus: http.StatusOK, wantSpan: true},
+		{name: "unauthorized admin request", path: "/admin/log-level", wantStatus: http.StatusUnauthorized, wantSpan: true},
+		{name: "liveness probe", path: "/healthz", wantStatus: http.StatusOK, wantSpan: false},
+		{name: "readiness probe", path: "/readyz", wantStatus: http.StatusOK, wantSpan: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder.Reset()
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set(middleware.TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+
+			spans := recorder.Ended()
+			if !tt.wantSpan {
+				assert.Empty(t, spans)
+				return
+			}
+			require.Len(t, spans, 1)
+			assert.Equal(t, "http.server", spans[0].Name())
+			assert.Equal(t, trace.SpanKindServer, spans[0].SpanKind())
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String(),
+				"the incoming trace is continued")
+			assert.NotEmpty(t, rec.Header().Get(middleware.RequestIDHeader))
+		})
+	}
+}
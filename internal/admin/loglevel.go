@@ -0,0 +1,160 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AtoyanMikhail/auth/internal/config"
+	"github.com/AtoyanMikhail/auth/internal/logger"
+)
+
+// LogLevelRequest is the body of PUT /admin/log-level
+type LogLevelRequest struct {
+	// Level is required: a missing level must not decode to the zero value, debug
+	Level *logger.Level `json:"level"`
+	// Sinks are the names of the sinks to change, every sink if empty
+	Sinks []string `json:"sinks,omitempty"`
+	// Duration reverts the change after it elapses, e.g. "10m"; the change is permanent if empty
+	Duration config.Duration `json:"duration,omitempty"`
+}
+
+// LogLevelResponse is the body of the responses of /admin/log-level
+type LogLevelResponse struct {
+	// Levels are the current levels of the sinks by name
+	Levels map[string]logger.Level `json:"levels"`
+	// RevertAt is the time the levels are reverted at, if a temporary change is active
+	RevertAt *time.Time `json:"revert_at,omitempty"`
+}
+
+// LogLevelHandler reports and changes the levels of a logger and its children created with With
+type LogLevelHandler struct {
+	l logger.Logger
+
+	mu       sync.Mutex
+	revert   *time.Timer
+	revertAt *time.Time
+	previous map[string]logger.Level
+	// generation invalidates the revert timers of the previous changes
+	generation int
+}
+
+// NewLogLevelHandler creates the handler of GET and PUT /admin/log-level for l
+func NewLogLevelHandler(l logger.Logger) *LogLevelHandler {
+	return &LogLevelHandler{l: l}
+}
+
+func (h *LogLevelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.writeLevels(w)
+	case http.MethodPut:
+		var req LogLevelRequest
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %s", err.Error()), http.StatusBadRequest)
+			return
+		}
+		if req.Level == nil {
+			http.Error(w, "invalid request: level is required", http.StatusBadRequest)
+			return
+		}
+
+		if err := h.SetLevel(*req.Level, time.Duration(req.Duration), req.Sinks...); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		logger.FromContextOr(r.Context(), h.l).Warn("Log level changed",
+			logger.String("level", req.Level.String()),
+			logger.Any("sinks", req.Sinks),
+			logger.String("duration", time.Duration(req.Duration).String()))
+
+		h.writeLevels(w)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// SetLevel sets the level of the named sinks, or of every sink if no names are given.
+// If d is positive, the previous levels are restored after d. Any pending restore is cancelled first.
+func (h *LogLevelHandler) SetLevel(level logger.Level, d time.Duration, sinks ...string) error {
+	levels := h.levels()
+	for _, name := range sinks {
+		if _, ok := levels[name]; !ok && levels != nil {
+			return fmt.Errorf("unknown log sink: %q", name)
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.restoreLocked()
+
+	previous := h.levels()
+	h.l.SetLevel(level, sinks...)
+
+	if d > 0 {
+		revertAt := time.Now().Add(d)
+		generation := h.generation
+		h.previous = previous
+		h.revertAt = &revertAt
+		h.revert = time.AfterFunc(d, func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+
+			if h.generation != generation {
+				return
+			}
+			h.restoreLocked()
+			h.l.Info("Log level reverted")
+		})
+	}
+
+	return nil
+}
+
+// Restore cancels a temporary change made by SetLevel and restores the previous levels right away
+func (h *LogLevelHandler) Restore() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.restoreLocked()
+}
+
+// restoreLocked restores the levels saved by a pending temporary change, if any
+func (h *LogLevelHandler) restoreLocked() {
+	h.generation++
+	if h.revert == nil {
+		return
+	}
+
+	h.revert.Stop()
+	for name, level := range h.previous {
+		h.l.SetLevel(level, name)
+	}
+	h.previous = nil
+	h.revert = nil
+	h.revertAt = nil
+}
+
+// levels returns the levels of the sinks of the logger, or nil if the logger can't report them
+func (h *LogLevelHandler) levels() map[string]logger.Level {
+	if sl, ok := h.l.(logger.SinkLeveler); ok {
+		return sl.Levels()
+	}
+	return nil
+}
+
+func (h *LogLevelHandler) writeLevels(w http.ResponseWriter) {
+	h.mu.Lock()
+	resp := LogLevelResponse{Levels: h.levels(), RevertAt: h.revertAt}
+	h.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,134 @@
+package admin
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AtoyanMikhail/auth/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHandler(t *testing.T) (*LogLevelHandler, logger.Logger) {
+	l, err := logger.NewWithSinks(
+		logger.Sink{Name: "stdout", Writer: &bytes.Buffer{}, Level: logger.InfoLevel},
+		logger.Sink{Name: "file", Writer: &bytes.Buffer{}, Level: logger.WarnLevel},
+	)
+	require.NoError(t, err)
+	return NewLogLevelHandler(l), l
+}
+
+func TestLogLevelHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		token      string
+		body       string
+		wantStatus int
+		wantLevels map[string]logger.Level
+	}{
+		{
+			name:       "get levels",
+			method:     http.MethodGet,
+			token:      "admin",
+			wantStatus: http.StatusOK,
+			wantLevels: map[string]logger.Level{"stdout": logger.InfoLevel, "file": logger.WarnLevel},
+		},
+		{
+			name:       "set level of every sink",
+			method:     http.MethodPut,
+			token:      "admin",
+			body:       `{"level": "debug"}`,
+			wantStatus: http.StatusOK,
+			wantLevels: map[string]logger.Level{"stdout": logger.DebugLevel, "file": logger.DebugLevel},
+		},
+		{
+			name:       "set level of a named sink",
+			method:     http.MethodPut,
+			token:      "admin",
+			body:       `{"level": "error", "sinks": ["file"]}`,
+			wantStatus: http.StatusOK,
+			wantLevels: map[string]logger.Level{"stdout": logger.InfoLevel, "file": logger.ErrorLevel},
+		},
+		{
+			name:       "unknown level",
+			method:     http.MethodPut,
+			token:      "admin",
+			body:       `{"level": "verbose"}`,
+			wantStatus: http.StatusBadRequest,
+			wantLevels: map[string]logger.Level{"stdout": logger.InfoLevel, "file": logger.WarnLevel},
+		},
+		{
+			name:       "missing level",
+			method:     http.MethodPut,
+			token:      "admin",
+			body:       `{"sinks": ["file"]}`,
+			wantStatus: http.StatusBadRequest,
+			wantLevels: map[string]logger.Level{"stdout": logger.InfoLevel, "file": logger.WarnLevel},
+		},
+		{
+			name:       "empty body",
+			method:     http.MethodPut,
+			token:      "admin",
+			body:       `{}`,
+			wantStatus: http.StatusBadRequest,
+			wantLevels: map[string]logger.Level{"stdout": logger.InfoLevel, "file": logger.WarnLevel},
+		},
+		{
+			name:       "unknown sink",
+			method:     http.MethodPut,
+			token:      "admin",
+			body:       `{"level": "debug", "sinks": ["kafka"]}`,
+			wantStatus: http.StatusBadRequest,
+			wantLevels: map[string]logger.Level{"stdout": logger.InfoLevel, "file": logger.WarnLevel},
+		},
+		{
+			name:       "wrong token",
+			method:     http.MethodPut,
+			token:      "guess",
+			body:       `{"level": "debug"}`,
+			wantStatus: http.StatusUnauthorized,
+			wantLevels: map[string]logger.Level{"stdout": logger.InfoLevel, "file": logger.WarnLevel},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, l := newTestHandler(t)
+
+			req := httptest.NewRequest(tt.method, "/admin/log-level", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			RequireToken("admin")(h).ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			assert.Equal(t, tt.wantLevels, l.(logger.SinkLeveler).Levels())
+		})
+	}
+}
+
+func TestLogLevelHandler_Revert(t *testing.T) {
+	h, l := newTestHandler(t)
+	leveler := l.(logger.SinkLeveler)
+
+	require.NoError(t, h.SetLevel(logger.DebugLevel, 20*time.Millisecond))
+	assert.Equal(t, logger.DebugLevel, leveler.Levels()["stdout"])
+
+	assert.Eventually(t, func() bool {
+		return leveler.Levels()["stdout"] == logger.InfoLevel && leveler.Levels()["file"] == logger.WarnLevel
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestRequireToken_Disabled(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/log-level", nil)
+	rec := httptest.NewRecorder()
+	RequireToken("")(h).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package admin
+
+import (
+	"context"
+	"time"
+)
+
+// HandleLevelSignals waits for ctx to be done: SIGUSR1 and SIGUSR2 are not available on this platform
+func HandleLevelSignals(ctx context.Context, h *LogLevelHandler, d time.Duration) {
+	<-ctx.Done()
+}
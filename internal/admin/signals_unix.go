@@ -0,0 +1,39 @@
+//go:build unix
+
+package admin
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/AtoyanMikhail/auth/internal/logger"
+)
+
+// HandleLevelSignals switches every sink to DebugLevel for d on SIGUSR1 and restores the previous levels
+// on SIGUSR2, until ctx is done
+func HandleLevelSignals(ctx context.Context, h *LogLevelHandler, d time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			if sig == syscall.SIGUSR2 {
+				h.Restore()
+				h.l.Warn("Log level restored by signal")
+				continue
+			}
+
+			_ = h.SetLevel(logger.DebugLevel, d)
+			h.l.Warn("Log level changed by signal",
+				logger.String("level", logger.DebugLevel.String()),
+				logger.String("duration", d.String()))
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/AtoyanMikhail/auth/internal/logger"
+)
+
+type job struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+type hook struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+type closer struct {
+	name  string
+	close func() error
+}
+
+// App runs the components of the service and stops them in order. On shutdown it runs the hooks in the order
+// they were added, e.g. to drain the HTTP server and flush queues, then stops the jobs and closes the resources
+// in the reverse order they were added, all within the shutdown timeout.
+type App struct {
+	l               logger.Logger
+	shutdownTimeout time.Duration
+
+	jobs    []job
+	hooks   []hook
+	closers []closer
+}
+
+// New creates an app draining within shutdownTimeout
+func New(l logger.Logger, shutdownTimeout time.Duration) *App {
+	return &App{l: l, shutdownTimeout: shutdownTimeout}
+}
+
+// Go adds a job running until its context is cancelled, e.g. a server or a background worker.
+// A job returning early with an error stops the app.
+func (a *App) Go(name string, run func(ctx context.Context) error) {
+	a.jobs = append(a.jobs, job{name: name, run: run})
+}
+
+// OnShutdown adds a hook run on shutdown, before the jobs are stopped
+func (a *App) OnShutdown(name string, run func(ctx context.Context) error) {
+	a.hooks = append(a.hooks, hook{name: name, run: run})
+}
+
+// OnClose adds a resource closed after the jobs have stopped
+func (a *App) OnClose(name string, close func() error) {
+	a.closers = append(a.closers, closer{name: name, close: close})
+}
+
+// Run starts the jobs and blocks until ctx is done or a job fails, then shuts the app down.
+// It returns the errors of the failed job, the hooks and the closers.
+func (a *App) Run(ctx context.Context) error {
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+
+	failed := make(chan error, len(a.jobs))
+	var wg sync.WaitGroup
+	for _, j := range a.jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := j.run(jobsCtx); err != nil && !errors.Is(err, context.Canceled) {
+				failed <- fmt.Errorf("%s: %w", j.name, err)
+			}
+		}()
+	}
+
+	var errs []error
+	select {
+	case <-ctx.Done():
+		a.l.Info("Shutting down", logger.String("timeout", a.shutdownTimeout.String()))
+	case err := <-failed:
+		a.l.Error("Job failed, shutting down", logger.Error(err))
+		errs = append(errs, err)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), a.shutdownTimeout)
+	defer cancel()
+
+	for _, h := range a.hooks {
+		if err := h.run(shutdownCtx); err != nil {
+			a.l.Error("Shutdown hook failed", logger.String("hook", h.name), logger.Error(err))
+			errs = append(errs, fmt.Errorf("%s: %w", h.name, err))
+		}
+	}
+
+	cancelJobs()
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-shutdownCtx.Done():
+		a.l.Error("Jobs did not stop within the shutdown timeout")
+		errs = append(errs, fmt.Errorf("jobs did not stop: %w", shutdownCtx.Err()))
+	}
+
+	// Jobs failing during the shutdown are reported as well
+	pending := len(failed)
+	for i := 0; i < pending; i++ {
+		errs = append(errs, <-failed)
+	}
+
+	for i := len(a.closers) - 1; i >= 0; i-- {
+		c := a.closers[i]
+		if err := c.close(); err != nil {
+			a.l.Error("Failed to close", logger.String("resource", c.name), logger.Error(err))
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+		}
+	}
+
+	a.l.Info("Shutdown complete")
+	return errors.Join(errs...)
+}
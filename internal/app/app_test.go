@@ -0,0 +1,119 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AtoyanMikhail/auth/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder records the steps of the shutdown in order
+type recorder struct {
+	mu    sync.Mutex
+	steps []string
+}
+
+func (r *recorder) add(step string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.steps = append(r.steps, step)
+}
+
+func TestApp_Run(t *testing.T) {
+	rec := &recorder{}
+	a := New(logger.New(io.Discard), time.Second)
+
+	a.Go("worker", func(ctx context.Context) error {
+		<-ctx.Done()
+		rec.add("worker stopped")
+		return ctx.Err()
+	})
+	a.OnShutdown("server", func(ctx context.Context) error {
+		rec.add("server drained")
+		return nil
+	})
+	a.OnShutdown("outbox", func(ctx context.Context) error {
+		rec.add("outbox flushed")
+		return nil
+	})
+	a.OnClose("postgres", func() error {
+		rec.add("postgres closed")
+		return nil
+	})
+	a.OnClose("redis", func() error {
+		rec.add("redis closed")
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	require.NoError(t, a.Run(ctx))
+	assert.Equal(t, []string{"server drained", "outbox flushed", "worker stopped", "redis closed", "postgres closed"}, rec.steps)
+}
+
+func TestApp_Run_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(a *App)
+		wantErr []string
+	}{
+		{
+			name: "failing job stops the app",
+			setup: func(a *App) {
+				a.Go("server", func(ctx context.Context) error {
+					return errors.New("address already in use")
+				})
+				a.Go("worker", func(ctx context.Context) error {
+					<-ctx.Done()
+					return nil
+				})
+			},
+			wantErr: []string{"server: address already in use"},
+		},
+		{
+			name: "job ignoring cancellation",
+			setup: func(a *App) {
+				a.Go("stuck", func(ctx context.Context) error {
+					time.Sleep(time.Second)
+					return nil
+				})
+			},
+			wantErr: []string{"jobs did not stop"},
+		},
+		{
+			name: "failing hook and closer",
+			setup: func(a *App) {
+				a.OnShutdown("server", func(ctx context.Context) error {
+					return errors.New("drain failed")
+				})
+				a.OnClose("redis", func() error {
+					return errors.New("close failed")
+				})
+			},
+			wantErr: []string{"server: drain failed", "redis: close failed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := New(logger.New(io.Discard), 50*time.Millisecond)
+			tt.setup(a)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			err := a.Run(ctx)
+			require.Error(t, err)
+			for _, msg := range tt.wantErr {
+				assert.ErrorContains(t, err, msg)
+			}
+		})
+	}
+}
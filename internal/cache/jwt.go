@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/AtoyanMikhail/auth/internal/logger"
+	"github.com/AtoyanMikhail/auth/internal/metrics"
 )
 
 type jwtCache struct {
@@ -22,6 +23,11 @@ func NewJWTCache(cache Cache, l logger.Logger) JWTCache {
 	}
 }
 
+// log returns the request scoped logger of ctx, falling back to the cache logger
+func (j *jwtCache) log(ctx context.Context) logger.Logger {
+	return logger.FromContextOr(ctx, j.logger)
+}
+
 // BlacklistToken blacklists token until expiresAt.
 func (j *jwtCache) BlacklistToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
 	key := TokenBlacklistPrefix + tokenID
@@ -29,20 +35,20 @@ func (j *jwtCache) BlacklistToken(ctx context.Context, tokenID string, expiresAt
 
 	// If token is already expired, don't add it to blacklist
 	if ttl <= 0 {
-		j.logger.Debug("Token already expired, not adding to blacklist",
+		j.log(ctx).Debug("Token already expired, not adding to blacklist",
 			logger.String("token_id", tokenID))
 		return nil
 	}
 
 	err := j.cache.Set(ctx, key, "blacklisted", ttl)
 	if err != nil {
-		j.logger.Error("Failed to blacklist token",
+		j.log(ctx).Error("Failed to blacklist token",
 			logger.String("token_id", tokenID),
 			logger.Error(err))
 		return fmt.Errorf("failed to blacklist token: %w", err)
 	}
 
-	j.logger.Info("Token blacklisted",
+	j.log(ctx).Info("Token blacklisted",
 		logger.String("token_id", tokenID),
 		logger.String("ttl", ttl.String()))
 
@@ -55,12 +61,16 @@ func (j *jwtCache) IsTokenBlacklisted(ctx context.Context, tokenID string) (bool
 
 	exists, err := j.cache.Exists(ctx, key)
 	if err != nil {
-		j.logger.Error("Failed to check token blacklist status",
+		j.log(ctx).Error("Failed to check token blacklist status",
 			logger.String("token_id", tokenID),
 			logger.Error(err))
 		return false, fmt.Errorf("failed to check token blacklist status: %w", err)
 	}
 
+	if exists {
+		metrics.BlacklistHits.WithLabelValues(metrics.BlacklistToken).Inc()
+	}
+
 	return exists, nil
 }
 
@@ -71,14 +81,14 @@ func (j *jwtCache) LogIPAttempt(ctx context.Context, userID, ipAddress string) e
 
 	count, err := j.cache.IncrementWithTTL(ctx, key, ttl)
 	if err != nil {
-		j.logger.Error("Failed to log IP attempt",
+		j.log(ctx).Error("Failed to log IP attempt",
 			logger.String("user_id", userID),
 			logger.String("ip", ipAddress),
 			logger.Error(err))
 		return fmt.Errorf("failed to log IP attempt: %w", err)
 	}
 
-	j.logger.Info("IP attempt logged",
+	j.log(ctx).Info("IP attempt logged",
 		logger.String("user_id", userID),
 		logger.String("ip", ipAddress),
 		logger.Int("attempts", int(count)))
@@ -96,7 +106,7 @@ func (j *jwtCache) GetIPAttempts(ctx context.Context, userID, ipAddress string)
 		if err.Error() == fmt.Sprintf("key not found: %s", key) {
 			return 0, nil
 		}
-		j.logger.Error("Failed to get IP attempts",
+		j.log(ctx).Error("Failed to get IP attempts",
 			logger.String("user_id", userID),
 			logger.String("ip", ipAddress),
 			logger.Error(err))
@@ -105,7 +115,7 @@ func (j *jwtCache) GetIPAttempts(ctx context.Context, userID, ipAddress string)
 
 	count, err := strconv.ParseInt(val, 10, 64)
 	if err != nil {
-		j.logger.Error("Failed to parse IP attempts count",
+		j.log(ctx).Error("Failed to parse IP attempts count",
 			logger.String("value", val),
 			logger.Error(err))
 		return 0, fmt.Errorf("failed to parse IP attempts count: %w", err)
@@ -120,13 +130,13 @@ func (j *jwtCache) BlacklistUser(ctx context.Context, userID string, duration ti
 
 	err := j.cache.Set(ctx, key, "blacklisted", duration)
 	if err != nil {
-		j.logger.Error("Failed to blacklist user",
+		j.log(ctx).Error("Failed to blacklist user",
 			logger.String("user_id", userID),
 			logger.Error(err))
 		return fmt.Errorf("failed to blacklist user: %w", err)
 	}
 
-	j.logger.Info("User blacklisted",
+	j.log(ctx).Info("User blacklisted",
 		logger.String("user_id", userID),
 		logger.String("duration", duration.String()))
 
@@ -139,11 +149,15 @@ func (j *jwtCache) IsUserBlacklisted(ctx context.Context, userID string) (bool,
 
 	exists, err := j.cache.Exists(ctx, key)
 	if err != nil {
-		j.logger.Error("Failed to check user blacklist status",
+		j.log(ctx).Error("Failed to check user blacklist status",
 			logger.String("user_id", userID),
 			logger.Error(err))
 		return false, fmt.Errorf("failed to check user blacklist status: %w", err)
 	}
 
+	if exists {
+		metrics.BlacklistHits.WithLabelValues(metrics.BlacklistUser).Inc()
+	}
+
 	return exists, nil
 }
@@ -2,12 +2,19 @@ package cache
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"net"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/AtoyanMikhail/auth/internal/config"
 	"github.com/AtoyanMikhail/auth/internal/logger"
+	"github.com/AtoyanMikhail/auth/internal/metrics"
+	"github.com/redis/go-redis/extra/redisotel/v9"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -19,30 +26,41 @@ const (
 )
 
 type redisCache struct {
-	client *redis.Client
+	client redis.UniversalClient
 	logger logger.Logger
 	cfg    config.RedisConfig
 }
 
-// NewRedisCache creates a new Redis cache instance
+// NewRedisCache creates a new Redis cache instance. The client matches the mode of cfg: a single node,
+// the master found through Sentinel or a Redis Cluster.
 func NewRedisCache(cfg config.RedisConfig, l logger.Logger) (Cache, error) {
-	opts := &redis.Options{
-		Addr:     cfg.Addr,
-		Password: cfg.Password,
-		DB:       cfg.DB,
+	client, err := newClient(cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	client := redis.NewClient(opts)
+	client.AddHook(metricsHook{})
+	// Spans are named after the command; the statement would export the keys, made of user IDs and IPs
+	if err := redisotel.InstrumentTracing(client, redisotel.WithDBStatement(false)); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to instrument Redis tracing: %w", err)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
+	addrs := cfg.Addr
+	if cfg.Mode != config.RedisStandalone {
+		addrs = strings.Join(cfg.Addrs, ",")
+	}
 	l.Info("Redis connection established",
-		logger.String("addr", cfg.Addr),
+		logger.String("mode", cfg.Mode),
+		logger.String("addr", addrs),
 		logger.Int("db", cfg.DB))
 
 	return &redisCache{
@@ -52,6 +70,98 @@ func NewRedisCache(cfg config.RedisConfig, l logger.Logger) (Cache, error) {
 	}, nil
 }
 
+// newClient creates the client of the mode of cfg without connecting
+func newClient(cfg config.RedisConfig) (redis.UniversalClient, error) {
+	tlsConfig, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &redis.UniversalOptions{
+		Addrs:            cfg.Addrs,
+		Password:         cfg.Password,
+		DB:               cfg.DB,
+		MasterName:       cfg.MasterName,
+		SentinelPassword: cfg.SentinelPassword,
+		PoolSize:         cfg.PoolSize,
+		MinIdleConns:     cfg.MinIdleConns,
+		DialTimeout:      time.Duration(cfg.DialTimeout),
+		ReadTimeout:      time.Duration(cfg.ReadTimeout),
+		WriteTimeout:     time.Duration(cfg.WriteTimeout),
+		TLSConfig:        tlsConfig,
+	}
+
+	switch cfg.Mode {
+	case config.RedisSentinel:
+		return redis.NewFailoverClient(opts.Failover()), nil
+	case config.RedisCluster:
+		return redis.NewClusterClient(opts.Cluster()), nil
+	case config.RedisStandalone:
+		opts.Addrs = []string{cfg.Addr}
+		return redis.NewClient(opts.Simple()), nil
+	default:
+		return nil, fmt.Errorf("unknown Redis mode: %q", cfg.Mode)
+	}
+}
+
+// newTLSConfig returns the TLS settings of the connections, nil if TLS is disabled
+func newTLSConfig(cfg config.RedisTLSConfig) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		ca, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in Redis CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Redis client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// metricsHook observes the latency of the commands sent to Redis
+type metricsHook struct{}
+
+func (metricsHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (metricsHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		defer metrics.Since(metrics.RedisCommandDuration.WithLabelValues(cmd.Name()), time.Now())
+		return next(ctx, cmd)
+	}
+}
+
+func (metricsHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		defer metrics.Since(metrics.RedisCommandDuration.WithLabelValues("pipeline"), time.Now())
+		return next(ctx, cmds)
+	}
+}
+
 // Set saves value by key with TTL
 func (r *redisCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
 	var data string
@@ -2,6 +2,8 @@ package cache
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -11,6 +13,9 @@ import (
 	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 type mockLogger struct{}
@@ -23,7 +28,7 @@ func (m *mockLogger) Fatal(msg string, fields ...logger.Field)  {}
 func (m *mockLogger) Panic(msg string, fields ...logger.Field)  {}
 func (m *mockLogger) With(fields ...logger.Field) logger.Logger { return m }
 func (m *mockLogger) Sync() error                               { return nil }
-func (m *mockLogger) SetLevel(level logger.Level)               {}
+func (m *mockLogger) SetLevel(level logger.Level, sinks ...string) {}
 
 // Test setup helper
 func SetupTestRedis(t *testing.T) (*redisCache, *miniredis.Miniredis, func()) {
@@ -358,6 +363,7 @@ func TestNewRedisCache(t *testing.T) {
 		{
 			name: "valid config",
 			cfg: config.RedisConfig{
+				Mode:     config.RedisStandalone,
 				Addr:     mr.Addr(),
 				Password: "",
 				DB:       0,
@@ -367,6 +373,7 @@ func TestNewRedisCache(t *testing.T) {
 		{
 			name: "invalid address",
 			cfg: config.RedisConfig{
+				Mode:     config.RedisStandalone,
 				Addr:     "invalid:99999",
 				Password: "",
 				DB:       0,
@@ -374,6 +381,41 @@ func TestNewRedisCache(t *testing.T) {
 			wantErr: true,
 			errMsg:  "failed to connect to Redis",
 		},
+		{
+			name: "cluster mode",
+			cfg: config.RedisConfig{
+				Mode:  config.RedisCluster,
+				Addrs: []string{mr.Addr()},
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown mode",
+			cfg: config.RedisConfig{
+				Mode: "replicated",
+				Addr: mr.Addr(),
+			},
+			wantErr: true,
+			errMsg:  "unknown Redis mode",
+		},
+		{
+			name: "missing mode",
+			cfg: config.RedisConfig{
+				Addr: mr.Addr(),
+			},
+			wantErr: true,
+			errMsg:  "unknown Redis mode: \"\"",
+		},
+		{
+			name: "missing CA file",
+			cfg: config.RedisConfig{
+				Mode: config.RedisStandalone,
+				Addr: mr.Addr(),
+				TLS:  config.RedisTLSConfig{Enabled: true, CAFile: "/nonexistent/ca.pem"},
+			},
+			wantErr: true,
+			errMsg:  "failed to read Redis CA file",
+		},
 	}
 
 	for _, tt := range tests {
@@ -398,3 +440,92 @@ func TestNewRedisCache(t *testing.T) {
 		})
 	}
 }
+
+func TestNewClient_Modes(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.RedisConfig
+		want interface{}
+	}{
+		{
+			name: "standalone",
+			cfg:  config.RedisConfig{Mode: config.RedisStandalone, Addr: "localhost:6379"},
+			want: &redis.Client{},
+		},
+		{
+			name: "sentinel",
+			cfg: config.RedisConfig{
+				Mode:       config.RedisSentinel,
+				Addrs:      []string{"sentinel-1:26379", "sentinel-2:26379"},
+				MasterName: "auth",
+			},
+			want: &redis.Client{},
+		},
+		{
+			name: "cluster",
+			cfg: config.RedisConfig{
+				Mode:  config.RedisCluster,
+				Addrs: []string{"node-1:6379", "node-2:6379"},
+			},
+			want: &redis.ClusterClient{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := newClient(tt.cfg)
+			require.NoError(t, err)
+			defer client.Close()
+
+			assert.IsType(t, tt.want, client)
+		})
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	tlsConfig, err := newTLSConfig(config.RedisTLSConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, tlsConfig)
+
+	tlsConfig, err = newTLSConfig(config.RedisTLSConfig{Enabled: true, ServerName: "redis.internal"})
+	require.NoError(t, err)
+	assert.Equal(t, "redis.internal", tlsConfig.ServerName)
+	assert.Nil(t, tlsConfig.RootCAs)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0o600))
+	_, err = newTLSConfig(config.RedisTLSConfig{Enabled: true, CAFile: caFile})
+	assert.ErrorContains(t, err, "no certificates found")
+
+	_, err = newTLSConfig(config.RedisTLSConfig{Enabled: true, CertFile: "/nonexistent/cert.pem", KeyFile: "/nonexistent/key.pem"})
+	assert.ErrorContains(t, err, "failed to load Redis client certificate")
+}
+
+func TestNewRedisCache_SpansWithoutKeys(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	mr := miniredis.RunT(t)
+	c, err := NewRedisCache(config.RedisConfig{Mode: config.RedisStandalone, Addr: mr.Addr()}, &mockLogger{})
+	require.NoError(t, err)
+	defer c.Close()
+
+	ctx := context.Background()
+	require.NoError(t, c.Set(ctx, UserBlacklistPrefix+"user-42", "secret-value", time.Minute))
+	_, err = c.IncrementWithTTL(ctx, IPAttemptPrefix+"user-42:10.1.2.3", time.Minute)
+	require.NoError(t, err)
+
+	var names []string
+	for _, span := range recorder.Ended() {
+		names = append(names, span.Name())
+		for _, attr := range span.Attributes() {
+			value := attr.Value.Emit()
+			for _, secret := range []string{"user-42", "10.1.2.3", "secret-value", "blacklist:", "ip_attempt:"} {
+				assert.NotContains(t, value, secret, "span %s attribute %s", span.Name(), attr.Key)
+			}
+		}
+	}
+	assert.Contains(t, names, "set")
+}
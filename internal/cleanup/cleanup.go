@@ -0,0 +1,119 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AtoyanMikhail/auth/internal/config"
+	"github.com/AtoyanMikhail/auth/internal/logger"
+	"github.com/AtoyanMikhail/auth/internal/metrics"
+)
+
+// LockKey is the Postgres advisory lock key held by the replica running the cleanup
+const LockKey int64 = 0x61757468_636c6e // "authcln"
+
+// Store is the part of the refresh token repository used by the cleanup
+type Store interface {
+	DeleteExpiredBatch(ctx context.Context, limit int) (int64, error)
+	DeleteUsedBatch(ctx context.Context, usedBefore time.Time, limit int) (int64, error)
+	TryLock(ctx context.Context, key int64) (unlock func() error, acquired bool, err error)
+}
+
+// Cleaner periodically deletes expired refresh tokens and used ones past their retention.
+// Only the replica holding the advisory lock runs a cleanup, the others skip it.
+type Cleaner struct {
+	store Store
+	cfg   config.CleanupConfig
+	l     logger.Logger
+	now   func() time.Time
+}
+
+// New creates a cleaner of store
+func New(store Store, cfg config.CleanupConfig, l logger.Logger) *Cleaner {
+	return &Cleaner{store: store, cfg: cfg, l: l, now: time.Now}
+}
+
+// Run cleans up right away, then every interval until ctx is done
+func (c *Cleaner) Run(ctx context.Context) error {
+	ticker := time.NewTicker(time.Duration(c.cfg.Interval))
+	defer ticker.Stop()
+
+	for {
+		if err := c.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			c.l.Error("Token cleanup failed", logger.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce deletes the expired and the used tokens in batches, if no other replica is cleaning up.
+// A failure to release the lock is returned along with the error of the cleanup, if any.
+func (c *Cleaner) RunOnce(ctx context.Context) (err error) {
+	unlock, acquired, err := c.store.TryLock(ctx, LockKey)
+	if err != nil {
+		metrics.CleanupRuns.WithLabelValues(metrics.CleanupError).Inc()
+		return err
+	}
+	if !acquired {
+		metrics.CleanupRuns.WithLabelValues(metrics.CleanupSkipped).Inc()
+		c.l.Debug("Token cleanup skipped, another replica holds the lock")
+		return nil
+	}
+	defer func() {
+		if unlockErr := unlock(); unlockErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to release the cleanup lock: %w", unlockErr))
+		}
+	}()
+
+	expired, err := c.deleteBatches(ctx, metrics.CleanupExpired, func(ctx context.Context) (int64, error) {
+		return c.store.DeleteExpiredBatch(ctx, c.cfg.BatchSize)
+	})
+	if err != nil {
+		metrics.CleanupRuns.WithLabelValues(metrics.CleanupError).Inc()
+		return err
+	}
+
+	usedBefore := c.now().Add(-time.Duration(c.cfg.UsedRetention))
+	used, err := c.deleteBatches(ctx, metrics.CleanupUsed, func(ctx context.Context) (int64, error) {
+		return c.store.DeleteUsedBatch(ctx, usedBefore, c.cfg.BatchSize)
+	})
+	if err != nil {
+		metrics.CleanupRuns.WithLabelValues(metrics.CleanupError).Inc()
+		return err
+	}
+
+	metrics.CleanupRuns.WithLabelValues(metrics.CleanupOK).Inc()
+	c.l.Info("Token cleanup completed",
+		logger.Any("expired_deleted", expired),
+		logger.Any("used_deleted", used))
+
+	return nil
+}
+
+// deleteBatches calls deleteBatch until a batch is not full and returns the total number deleted
+func (c *Cleaner) deleteBatches(ctx context.Context, kind string, deleteBatch func(ctx context.Context) (int64, error)) (int64, error) {
+	var total int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+
+		n, err := deleteBatch(ctx)
+		if err != nil {
+			return total, fmt.Errorf("failed to delete %s tokens: %w", kind, err)
+		}
+		total += n
+		metrics.CleanupDeleted.WithLabelValues(kind).Add(float64(n))
+
+		if n < int64(c.cfg.BatchSize) {
+			return total, nil
+		}
+	}
+}
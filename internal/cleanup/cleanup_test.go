@@ -0,0 +1,169 @@
+package cleanup
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/AtoyanMikhail/auth/internal/config"
+	"github.com/AtoyanMikhail/auth/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Mock store returning the configured batches in order
+type mockStore struct {
+	locked     bool
+	lockErr    error
+	expired    []int64
+	used       []int64
+	deleteErr  error
+	usedBefore time.Time
+	unlocked   bool
+	unlockErr  error
+	runs       int
+}
+
+func (m *mockStore) DeleteExpiredBatch(ctx context.Context, limit int) (int64, error) {
+	if m.deleteErr != nil {
+		return 0, m.deleteErr
+	}
+	return pop(&m.expired), nil
+}
+
+func (m *mockStore) DeleteUsedBatch(ctx context.Context, usedBefore time.Time, limit int) (int64, error) {
+	m.usedBefore = usedBefore
+	return pop(&m.used), nil
+}
+
+func (m *mockStore) TryLock(ctx context.Context, key int64) (func() error, bool, error) {
+	m.runs++
+	if m.lockErr != nil || m.locked {
+		return nil, false, m.lockErr
+	}
+	return func() error {
+		m.unlocked = true
+		return m.unlockErr
+	}, true, nil
+}
+
+func pop(batches *[]int64) int64 {
+	if len(*batches) == 0 {
+		return 0
+	}
+	n := (*batches)[0]
+	*batches = (*batches)[1:]
+	return n
+}
+
+func TestCleaner_RunOnce(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	cfg := config.CleanupConfig{
+		Interval:      config.Duration(time.Hour),
+		BatchSize:     100,
+		UsedRetention: config.Duration(24 * time.Hour),
+	}
+
+	tests := []struct {
+		name         string
+		store        *mockStore
+		wantErr      string
+		wantExpired  []int64
+		wantUnlocked bool
+	}{
+		{
+			name:         "deletes batches until one is not full",
+			store:        &mockStore{expired: []int64{100, 100, 42, 7}, used: []int64{3}},
+			wantExpired:  []int64{7},
+			wantUnlocked: true,
+		},
+		{
+			name:        "skipped when another replica holds the lock",
+			store:       &mockStore{locked: true, expired: []int64{100}},
+			wantExpired: []int64{100},
+		},
+		{
+			name:    "lock error",
+			store:   &mockStore{lockErr: errors.New("connection refused")},
+			wantErr: "connection refused",
+		},
+		{
+			name:         "unlock error is returned",
+			store:        &mockStore{expired: []int64{7}, unlockErr: errors.New("connection reset")},
+			wantErr:      "failed to release the cleanup lock: connection reset",
+			wantUnlocked: true,
+		},
+		{
+			name:         "delete and unlock errors are both returned",
+			store:        &mockStore{deleteErr: errors.New("deadlock detected"), unlockErr: errors.New("connection reset")},
+			wantErr:      "deadlock detected\nfailed to release the cleanup lock: connection reset",
+			wantUnlocked: true,
+		},
+		{
+			name:         "delete error releases the lock",
+			store:        &mockStore{deleteErr: errors.New("deadlock detected")},
+			wantErr:      "failed to delete expired tokens: deadlock detected",
+			wantUnlocked: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(tt.store, cfg, logger.New(io.Discard))
+			c.now = func() time.Time { return now }
+
+			err := c.RunOnce(context.Background())
+
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantExpired, tt.store.expired)
+			}
+			assert.Equal(t, tt.wantUnlocked, tt.store.unlocked)
+		})
+	}
+}
+
+func TestCleaner_RunOnce_Retention(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	store := &mockStore{}
+	c := New(store, config.CleanupConfig{BatchSize: 10, UsedRetention: config.Duration(48 * time.Hour)}, logger.New(io.Discard))
+	c.now = func() time.Time { return now }
+
+	require.NoError(t, c.RunOnce(context.Background()))
+	assert.Equal(t, now.Add(-48*time.Hour), store.usedBefore)
+}
+
+// Mock store signaling the runs of the cleanup
+type notifyingStore struct {
+	mockStore
+	ran chan struct{}
+}
+
+func (n *notifyingStore) TryLock(ctx context.Context, key int64) (func() error, bool, error) {
+	n.ran <- struct{}{}
+	return n.mockStore.TryLock(ctx, key)
+}
+
+func TestCleaner_Run_StartsRightAway(t *testing.T) {
+	store := &notifyingStore{ran: make(chan struct{}, 1)}
+	c := New(store, config.CleanupConfig{Interval: config.Duration(time.Hour), BatchSize: 10}, logger.New(io.Discard))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+
+	select {
+	case <-store.ran:
+	case <-time.After(time.Second):
+		t.Fatal("the first cleanup waits for the interval")
+	}
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Equal(t, 1, store.runs)
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// secureSSLModes are the Postgres sslmode values accepted in prod
+var secureSSLModes = []string{"require", "verify-ca", "verify-full"}
+
+// dsnSSLMode returns the sslmode of a Postgres DSN, either a postgres:// URL or libpq key=value pairs,
+// or an empty string if it is not set. Errors never contain the DSN, as it may contain a password.
+func dsnSSLMode(dsn string) (string, error) {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", errors.New("invalid dsn url")
+		}
+		return u.Query().Get("sslmode"), nil
+	}
+
+	params, err := parseKeyValueDSN(dsn)
+	if err != nil {
+		return "", err
+	}
+	return params["sslmode"], nil
+}
+
+// parseKeyValueDSN parses libpq key=value pairs: whitespace around "=" is allowed, values may be single-quoted,
+// and a backslash escapes the next character. The last value of a repeated key wins.
+func parseKeyValueDSN(dsn string) (map[string]string, error) {
+	params := map[string]string{}
+	s := []rune(dsn)
+	i := 0
+
+	skipSpaces := func() {
+		for i < len(s) && isDSNSpace(s[i]) {
+			i++
+		}
+	}
+
+	for {
+		skipSpaces()
+		if i >= len(s) {
+			return params, nil
+		}
+
+		start := i
+		for i < len(s) && s[i] != '=' && !isDSNSpace(s[i]) {
+			i++
+		}
+		key := string(s[start:i])
+
+		skipSpaces()
+		if i >= len(s) || s[i] != '=' || key == "" {
+			return nil, errors.New("invalid dsn: expected key=value pairs")
+		}
+		i++
+		skipSpaces()
+
+		var value strings.Builder
+		quoted := i < len(s) && s[i] == '\''
+		if quoted {
+			i++
+		}
+		for ; i < len(s); i++ {
+			c := s[i]
+			if quoted && c == '\'' {
+				break
+			}
+			if !quoted && isDSNSpace(c) {
+				break
+			}
+			if c == '\\' && i+1 < len(s) {
+				i++
+				c = s[i]
+			}
+			value.WriteRune(c)
+		}
+		if quoted {
+			if i >= len(s) {
+				return nil, errors.New("invalid dsn: unterminated quoted value")
+			}
+			i++
+		}
+
+		params[key] = value.String()
+	}
+}
+
+func isDSNSpace(c rune) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -3,13 +3,14 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
 )
 
-// Duration is an alias of time.Duration used for deserializing time string from json 
+// Duration is an alias of time.Duration used for deserializing time string from json, yaml, toml and env
 type Duration time.Duration
 
-func (duration Duration) UnmarshalJSON(b []byte) error {
+func (duration *Duration) UnmarshalJSON(b []byte) error {
 	var unmarshalledJson interface{}
 
 	err := json.Unmarshal(b, &unmarshalledJson)
@@ -19,16 +20,38 @@ func (duration Duration) UnmarshalJSON(b []byte) error {
 
 	switch value := unmarshalledJson.(type) {
 	case float64:
-		duration = Duration(time.Duration(value))
+		*duration = Duration(time.Duration(value))
 	case string:
 		d, err := time.ParseDuration(value)
-		duration = Duration(d)
 		if err != nil {
 			return err
 		}
+		*duration = Duration(d)
 	default:
 		return fmt.Errorf("invalid duration: %#v", unmarshalledJson)
 	}
 
 	return nil
 }
+
+// UnmarshalText parses durations for yaml, toml and env sources. A bare integer is treated as nanoseconds, the same way json numbers are.
+func (duration *Duration) UnmarshalText(text []byte) error {
+	value := string(text)
+
+	if ns, err := strconv.ParseInt(value, 10, 64); err == nil {
+		*duration = Duration(time.Duration(ns))
+		return nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid duration: %q", value)
+	}
+	*duration = Duration(d)
+
+	return nil
+}
+
+func (duration Duration) String() string {
+	return time.Duration(duration).String()
+}
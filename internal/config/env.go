@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// EnvVar describes an environment variable supported by Config
+type EnvVar struct {
+	// Name is the full variable name, e.g. "REDIS_ADDR"
+	Name string
+	// Path is the config path set by the variable, e.g. "redis.addr"
+	Path string
+	// Type is a human readable type: string, int, bool, duration or list
+	Type string
+	// Default is the value set by Defaults, redacted for secrets
+	Default string
+	// Secret is true if the value may also be read from a file with the <Name>_FILE variable
+	Secret bool
+}
+
+// EnvVars lists every environment variable supported by Config, generated from the env and envPrefix struct tags
+func EnvVars() []EnvVar {
+	cfg := &Config{}
+	setDefaults(cfg)
+
+	var vars []EnvVar
+	walkFields(cfg, func(f field) error {
+		if f.Env == "" {
+			return nil
+		}
+
+		v := EnvVar{
+			Name:    f.Env,
+			Path:    f.Path,
+			Type:    typeName(f.Value.Type()),
+			Default: formatValue(f.Value),
+			Secret:  f.Secret,
+		}
+		if f.Secret && v.Default != "" {
+			v.Default = RedactedValue
+		}
+		vars = append(vars, v)
+
+		return nil
+	})
+
+	return vars
+}
+
+// typeName returns a human readable name of the field type
+func typeName(t reflect.Type) string {
+	if t == reflect.TypeOf(Duration(0)) {
+		return "duration"
+	}
+
+	switch t.Kind() {
+	case reflect.Slice:
+		return "list"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "int"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "uint"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	default:
+		return t.Kind().String()
+	}
+}
+
+// formatValue formats a field value the way it is written in an environment variable
+func formatValue(v reflect.Value) string {
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	if v.Kind() == reflect.Slice {
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = formatValue(v.Index(i))
+		}
+		return strings.Join(items, ",")
+	}
+
+	return fmt.Sprint(v.Interface())
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// field describes a leaf value of the Config struct
+type field struct {
+	// Path is the dotted json path of the field, e.g. "jwt.secret_key"
+	Path string
+	// Env is the full environment variable name, e.g. "JWT_SECRET_KEY"
+	Env string
+	// Secret is true for fields tagged with secret:"true"
+	Secret bool
+	Value  reflect.Value
+	Struct reflect.StructField
+}
+
+// walkFields calls fn for every leaf field of cfg. Nested structs are descended into, composing env names
+// from envPrefix tags the same way github.com/caarlos0/env does.
+func walkFields(cfg *Config, fn func(f field) error) error {
+	return walkStruct(reflect.ValueOf(cfg).Elem(), "", "", fn)
+}
+
+func walkStruct(v reflect.Value, pathPrefix, envPrefix string, fn func(f field) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		name := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		path := pathPrefix + name
+
+		fv := v.Field(i)
+		if prefix, ok := sf.Tag.Lookup("envPrefix"); ok && fv.Kind() == reflect.Struct {
+			if err := walkStruct(fv, path+".", envPrefix+prefix, fn); err != nil {
+				return err
+			}
+			continue
+		}
+
+		f := field{
+			Path:   path,
+			Secret: sf.Tag.Get("secret") == "true",
+			Value:  fv,
+			Struct: sf,
+		}
+		if name, ok := sf.Tag.Lookup("env"); ok {
+			f.Env = envPrefix + strings.Split(name, ",")[0]
+		}
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,57 +1,183 @@
 package config
 
 import (
-	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
+)
 
-	"log"
+var (
+	// SearchDirs are the directories scanned for a config file when neither --config nor CONFIG_PATH is set
+	SearchDirs = []string{".", filepath.Join("configs", "app"), "config"}
+	// SearchNames are the file names looked up in every directory of SearchDirs, in order of preference.
+	// The config_local files shipped in configs/app are found when running from the repository root.
+	SearchNames = []string{
+		"config.yaml", "config.yml", "config.toml", "config.json",
+		"config_local.yaml", "config_local.yml", "config_local.toml", "config_local.json",
+	}
 
-	"github.com/caarlos0/env/v10"
-	"github.com/go-playground/validator/v10"
+	globalFlags *Flags
 )
 
-// GetConfig sets default values to the Config struct, then tries to override them with a .json config file (the path is stored in the CONFIG_PATH environment variable),
-// and finally overrides values from environment variables on the first usage. Then, it returns a pointer to the global config instance.
-func GetConfig() (*Config, error) {
-	initOnce.Do(func() {
-		setDefaults(&globalConfig)
+// Loader builds a Config by applying its sources in order and validating the result.
+// Every Loader is independent, so tests and embedders may build as many configs as they need.
+type Loader struct {
+	sources []Source
+}
 
-		// Overriding values from json if it is possible
-		if err := loadFromJSON(&globalConfig); err != nil {
-			log.Printf("failed to load config from JSON: %s\n", err.Error())
-		}
+// NewLoader creates a loader applying sources in the given order: later sources override earlier ones.
+func NewLoader(sources ...Source) *Loader {
+	return &Loader{sources: sources}
+}
+
+// Load applies every source to an empty Config and validates it. Errors of all sources and all validation
+// violations are aggregated into one error, so that every problem is reported at once.
+func (l *Loader) Load() (*Config, error) {
+	cfg, _, err := l.load(false)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadWithOrigins is like Load, but also reports which source set every value. Unlike Load, it returns the merged
+// config along with the error, so that an invalid config can still be inspected.
+func (l *Loader) LoadWithOrigins() (*Config, Origins, error) {
+	return l.load(true)
+}
+
+func (l *Loader) load(trackOrigins bool) (*Config, Origins, error) {
+	cfg := &Config{}
+
+	var origins Origins
+	var snapshot map[string]string
+	if trackOrigins {
+		origins = Origins{}
+		snapshot = snapshotValues(cfg)
+	}
 
-		// Overriding values from env
-		loadFromEnv(&globalConfig)
+	var errs []error
+	for _, src := range l.sources {
+		if err := src.Load(cfg); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", src.Name(), err))
+		}
 
-		if err := validate(&globalConfig); err != nil {
-			log.Fatalf("config validation failed: %s", err.Error())
+		if trackOrigins {
+			next := snapshotValues(cfg)
+			for path, value := range next {
+				if snapshot[path] != value {
+					origins[path] = src.Name()
+				}
+			}
+			snapshot = next
 		}
+	}
+
+	if err := validate(cfg); err != nil {
+		errs = append(errs, err)
+	}
+
+	return cfg, origins, errors.Join(errs...)
+}
+
+// Flags holds the command line flags of the config package
+type Flags struct {
+	// ConfigPath is the value of the --config flag
+	ConfigPath string
+	// Overrides are the values of the repeatable --set flag
+	Overrides Overrides
+}
+
+// BindFlags registers the --config and --set flags in the flag set and returns their values, which are populated
+// once the flag set is parsed. The flags are also used by GetConfig.
+func BindFlags(fs *flag.FlagSet) *Flags {
+	flags := &Flags{Overrides: Overrides{}}
+	fs.StringVar(&flags.ConfigPath, "config", "", "path to a .json, .yaml/.yml or .toml config file (overrides CONFIG_PATH)")
+	fs.Var(flags.Overrides, "set", "override a config value by its path, e.g. --set server.port=9090 (repeatable)")
+
+	globalFlags = flags
+	return flags
+}
+
+// DefaultSources returns the sources used by GetConfig, in order:
+//  1. defaults (see setDefaults);
+//  2. the config file: --config, then CONFIG_PATH, then the first existing file of SearchDirs and SearchNames,
+//     e.g. configs/app/config.yaml. If nothing is set and no file is found, the file source is skipped;
+//  3. environment variables;
+//  4. secrets from *_FILE environment variables and file:// references (see SecretFiles);
+//  5. --set flags.
+//
+// flags may be nil.
+func DefaultSources(flags *Flags) []Source {
+	if flags == nil {
+		flags = &Flags{}
+	}
+
+	sources := []Source{Defaults()}
+
+	if path := ResolveConfigPath(flags); path != "" {
+		sources = append(sources, File(path))
+	}
+
+	return append(sources, Env(nil), SecretFiles(nil), flags.Overrides)
+}
+
+// ResolveConfigPath returns the config file used by DefaultSources: --config, then CONFIG_PATH, then the first existing
+// file of SearchDirs and SearchNames. An empty string is returned if there is none. flags may be nil.
+func ResolveConfigPath(flags *Flags) string {
+	if flags != nil && flags.ConfigPath != "" {
+		return flags.ConfigPath
+	}
+	if path := os.Getenv("CONFIG_PATH"); path != "" {
+		return path
+	}
+	return findConfigFile(SearchDirs, SearchNames)
+}
+
+// GetConfig loads the global config instance with DefaultSources on the first usage and returns it,
+// or an error listing every problem found (see ValidationError). Flags registered with BindFlags are taken into account.
+func GetConfig() (*Config, error) {
+	initOnce.Do(func() {
+		globalConfig, initErr = NewLoader(DefaultSources(globalFlags)...).Load()
 	})
 
-	return &globalConfig, nil
+	return globalConfig, initErr
 }
 
 func setDefaults(cfg *Config) {
+	cfg.Environment = EnvDev
+
 	cfg.Server = ServerConfig{
-		Port:         "8080",
-		Host:         "0.0.0.0",
-		ReadTimeout:  Duration(30 * time.Second),
-		WriteTimeout: Duration(30 * time.Second),
+		Port:            "8080",
+		Host:            "0.0.0.0",
+		ReadTimeout:     Duration(30 * time.Second),
+		WriteTimeout:    Duration(30 * time.Second),
+		ShutdownTimeout: Duration(30 * time.Second),
 	}
 
 	cfg.Database = DatabaseConfig{
-		Host:     "localhost",
-		Port:     "5432",
-		User:     "postgres",
-		Password: "password",
-		DBName:   "jwt",
-		SSLMode:  "disable",
+		Host:           "localhost",
+		Port:           "5432",
+		User:           "postgres",
+		Password:       "password",
+		DBName:         "jwt",
+		SSLMode:        "disable",
+		MigrationsPath: "migrations",
+
+		MaxOpenConns:    25,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: Duration(30 * time.Minute),
+		ConnMaxIdleTime: Duration(5 * time.Minute),
+		ConnectRetries:  5,
+		ConnectBackoff:  Duration(time.Second),
 	}
 
 	cfg.Redis = RedisConfig{
+		Mode:     RedisStandalone,
 		Addr:     "localhost:6379",
 		Password: "",
 		DB:       0,
@@ -68,44 +194,103 @@ func setDefaults(cfg *Config) {
 		URL:     "",
 		Timeout: Duration(5 * time.Second),
 	}
-}
 
-func loadFromJSON(cfg *Config) error {
-	configPath := getConfigPath()
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		return nil
+	cfg.Log = LogConfig{
+		Level:      "info",
+		Format:     "json",
+		Outputs:    []string{"stdout"},
+		Caller:     true,
+		TimeFormat: "iso8601",
+		Rotation: LogRotationConfig{
+			Enabled:    false,
+			MaxSizeMB:  100,
+			MaxAgeDays: 30,
+			MaxBackups: 10,
+			Compress:   false,
+		},
+		Redaction: LogRedactionConfig{
+			MaskKeys:     []string{"password", "secret", "token", "access_token", "refresh_token", "authorization"},
+			HashKeys:     nil,
+			HashKey:      "",
+			DetectTokens: true,
+			GDPR:         false,
+		},
+		Sampling: LogSamplingConfig{
+			Enabled:    false,
+			Tick:       Duration(time.Second),
+			First:      100,
+			Thereafter: 100,
+			Levels:     []string{"debug", "info"},
+		},
 	}
 
-	file, err := os.Open(configPath)
-	if err != nil {
-		return err
+	cfg.Tracing = TracingConfig{
+		Enabled:     false,
+		ServiceName: "auth",
+		Exporter:    "otlp",
+		Endpoint:    "localhost:4317",
+		Insecure:    true,
+		SampleRatio: 1,
 	}
-	defer file.Close()
 
-	return json.NewDecoder(file).Decode(cfg)
-}
+	cfg.Admin = AdminConfig{
+		Token:         "",
+		DebugDuration: Duration(15 * time.Minute),
+	}
 
-// loadFromEnv unmarshalles env variables for config from enviroment
-func loadFromEnv(cfg *Config) {
-	_ = env.Parse(cfg)
-}
+	cfg.TokenHash = TokenHashConfig{
+		Pepper:            "changeme",
+		Algorithm:         "sha256",
+		BcryptCost:        10,
+		Argon2MemoryKiB:   64 * 1024,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 4,
+	}
 
-// getConfigPaths reads path to .json config from CONFIG_PATH env variable
-func getConfigPath() string {
-	if path := os.Getenv("CONFIG_PATH"); path != "" {
-		return path
+	cfg.Cleanup = CleanupConfig{
+		Enabled:       true,
+		Interval:      Duration(time.Hour),
+		BatchSize:     1000,
+		UsedRetention: Duration(7 * 24 * time.Hour),
+	}
+
+	cfg.Lockout = LockoutConfig{
+		MaxAttempts:       5,
+		Window:            Duration(24 * time.Hour),
+		BlacklistDuration: Duration(15 * time.Minute),
 	}
-	return filepath.Join("config", "config.json")
 }
 
-func validate(cfg *Config) error {
-	validate := validator.New()
+// findConfigFile returns the first existing file named one of names in one of dirs, or an empty string
+func findConfigFile(dirs, names []string) string {
+	for _, dir := range dirs {
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path
+			}
+		}
+	}
+
+	return ""
+}
 
-	// Custom validation for Duration type: must be greater than 0
-	validate.RegisterValidation("duration_gt0", func(fl validator.FieldLevel) bool {
-		d, ok := fl.Field().Interface().(Duration)
-		return ok && d > 0
-	})
+// lookupFunc returns a lookup over environ, or over the process environment if environ is nil
+func lookupFunc(environ map[string]string) func(key string) (string, bool) {
+	if environ == nil {
+		return os.LookupEnv
+	}
+	return func(key string) (string, bool) {
+		value, ok := environ[key]
+		return value, ok
+	}
+}
 
-	return validate.Struct(cfg)
+// splitOverride splits "path=value" of a --set flag
+func splitOverride(s string) (string, string, error) {
+	path, value, ok := strings.Cut(s, "=")
+	if !ok || path == "" {
+		return "", "", fmt.Errorf("invalid override %q: expected path=value", s)
+	}
+	return path, value, nil
 }
@@ -0,0 +1,339 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test config file helper
+func writeConfigFile(t *testing.T, name, content string, perm os.FileMode) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), perm))
+	return path
+}
+
+func TestLoader_Load(t *testing.T) {
+	yamlConfig := `
+server:
+  port: "9000"
+  read_timeout: 10s
+redis:
+  db: 2
+`
+	tomlConfig := `
+[server]
+port = "9001"
+write_timeout = "45s"
+`
+
+	tests := []struct {
+		name    string
+		sources func(t *testing.T) []Source
+		check   func(t *testing.T, cfg *Config)
+		wantErr []string
+	}{
+		{
+			name: "defaults only",
+			sources: func(t *testing.T) []Source {
+				return []Source{Defaults()}
+			},
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, EnvDev, cfg.Environment)
+				assert.Equal(t, "8080", cfg.Server.Port)
+				assert.Equal(t, Duration(15*time.Minute), cfg.JWT.AccessTokenTTL)
+			},
+		},
+		{
+			name: "yaml file overrides defaults",
+			sources: func(t *testing.T) []Source {
+				return []Source{Defaults(), File(writeConfigFile(t, "config.yaml", yamlConfig, 0o600))}
+			},
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "9000", cfg.Server.Port)
+				assert.Equal(t, Duration(10*time.Second), cfg.Server.ReadTimeout)
+				assert.Equal(t, Duration(30*time.Second), cfg.Server.WriteTimeout)
+				assert.Equal(t, 2, cfg.Redis.DB)
+			},
+		},
+		{
+			name: "toml file overrides defaults",
+			sources: func(t *testing.T) []Source {
+				return []Source{Defaults(), File(writeConfigFile(t, "config.toml", tomlConfig, 0o600))}
+			},
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "9001", cfg.Server.Port)
+				assert.Equal(t, Duration(45*time.Second), cfg.Server.WriteTimeout)
+			},
+		},
+		{
+			name: "env overrides file and flags override env",
+			sources: func(t *testing.T) []Source {
+				return []Source{
+					Defaults(),
+					File(writeConfigFile(t, "config.yaml", yamlConfig, 0o600)),
+					Env(map[string]string{"SERVER_PORT": "9100", "JWT_ACCESS_TOKEN_TTL": "1m"}),
+					Overrides{"jwt.access_token_ttl": "2m"},
+				}
+			},
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "9100", cfg.Server.Port)
+				assert.Equal(t, Duration(2*time.Minute), cfg.JWT.AccessTokenTTL)
+			},
+		},
+		{
+			name: "redis env names",
+			sources: func(t *testing.T) []Source {
+				return []Source{Defaults(), Env(map[string]string{"REDIS_ADDR": "redis:6379", "REDIS_DB": "4"})}
+			},
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "redis:6379", cfg.Redis.Addr)
+				assert.Equal(t, 4, cfg.Redis.DB)
+			},
+		},
+		{
+			name: "dsn replaces the connection settings",
+			sources: func(t *testing.T) []Source {
+				return []Source{
+					Defaults(),
+					Env(map[string]string{"DB_DSN": "postgres://auth@db/jwt"}),
+					Overrides{"database.host": "", "database.password": "", "database.ssl_mode": ""},
+				}
+			},
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "postgres://auth@db/jwt", cfg.Database.DSN)
+				assert.Empty(t, cfg.Database.Host)
+			},
+		},
+		{
+			name: "redis sentinel from env",
+			sources: func(t *testing.T) []Source {
+				return []Source{Defaults(), Env(map[string]string{
+					"REDIS_MODE":        "sentinel",
+					"REDIS_ADDRS":       "sentinel-1:26379,sentinel-2:26379",
+					"REDIS_MASTER_NAME": "auth",
+					"REDIS_TLS_ENABLED": "true",
+				})}
+			},
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, RedisSentinel, cfg.Redis.Mode)
+				assert.Equal(t, []string{"sentinel-1:26379", "sentinel-2:26379"}, cfg.Redis.Addrs)
+				assert.Equal(t, "auth", cfg.Redis.MasterName)
+				assert.True(t, cfg.Redis.TLS.Enabled)
+			},
+		},
+		{
+			name: "invalid redis sentinel and cluster settings",
+			sources: func(t *testing.T) []Source {
+				return []Source{Defaults(), Overrides{"redis.mode": "cluster", "redis.db": "2", "redis.tls.key_file": "/tls/key.pem"}}
+			},
+			wantErr: []string{"redis.addrs: failed on the 'required_unless=Mode standalone' rule", "redis.db: must be 0 in cluster mode", "redis.tls.cert_file"},
+		},
+		{
+			name: "secret from _FILE variable",
+			sources: func(t *testing.T) []Source {
+				path := writeConfigFile(t, "jwt_secret", "from-file\n", 0o600)
+				environ := map[string]string{"JWT_SECRET_KEY_FILE": path}
+				return []Source{Defaults(), Env(environ), SecretFiles(environ)}
+			},
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "from-file", cfg.JWT.SecretKey)
+			},
+		},
+		{
+			name: "secret from file:// reference",
+			sources: func(t *testing.T) []Source {
+				path := writeConfigFile(t, "db_password", "db-secret", 0o400)
+				environ := map[string]string{"DB_PASSWORD": FileRefPrefix + path}
+				return []Source{Defaults(), Env(environ), SecretFiles(environ)}
+			},
+			check: func(t *testing.T, cfg *Config) {
+				assert.Equal(t, "db-secret", cfg.Database.Password)
+			},
+		},
+		{
+			name: "world writable secret file",
+			sources: func(t *testing.T) []Source {
+				path := writeConfigFile(t, "jwt_secret", "from-file", 0o600)
+				require.NoError(t, os.Chmod(path, 0o666))
+				environ := map[string]string{"JWT_SECRET_KEY_FILE": path}
+				return []Source{Defaults(), SecretFiles(environ)}
+			},
+			wantErr: []string{"jwt.secret_key", "insecure permissions"},
+		},
+		{
+			name: "errors of all sources are aggregated",
+			sources: func(t *testing.T) []Source {
+				return []Source{
+					Defaults(),
+					File(filepath.Join(t.TempDir(), "missing.yaml")),
+					Env(map[string]string{"SERVER_PORT": "not-a-port"}),
+					Overrides{"server.unknown": "1"},
+				}
+			},
+			wantErr: []string{"missing.yaml", "unknown config path \"server.unknown\"", "server.port: failed on the 'numeric' rule"},
+		},
+		{
+			name: "insecure defaults in prod",
+			sources: func(t *testing.T) []Source {
+				return []Source{Defaults(), Env(map[string]string{"APP_ENV": "prod"})}
+			},
+			wantErr: []string{"jwt.secret_key", "token_hash.pepper", "database.password", "database.ssl_mode", "redis.password"},
+		},
+		{
+			name: "insecure dsns in prod",
+			sources: func(t *testing.T) []Source {
+				return []Source{Defaults(), Env(map[string]string{
+					"APP_ENV":         "prod",
+					"DB_DSN":          "postgres://auth:secret@db/auth?sslmode=prefer",
+					"DB_REPLICA_DSNS": "host=replica sslmode=require,host=replica2",
+				})}
+			},
+			wantErr: []string{"database.dsn: sslmode must be one of", "database.replica_dsns[1]: sslmode must be one of"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := NewLoader(tt.sources(t)...).Load()
+
+			if len(tt.wantErr) > 0 {
+				require.Error(t, err)
+				assert.Nil(t, cfg)
+				for _, msg := range tt.wantErr {
+					assert.Contains(t, err.Error(), msg)
+				}
+				return
+			}
+
+			require.NoError(t, err)
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestLoader_Independent(t *testing.T) {
+	first, err := NewLoader(Defaults(), Overrides{"server.port": "1111"}).Load()
+	require.NoError(t, err)
+
+	second, err := NewLoader(Defaults(), Overrides{"server.port": "2222"}).Load()
+	require.NoError(t, err)
+
+	assert.Equal(t, "1111", first.Server.Port)
+	assert.Equal(t, "2222", second.Server.Port)
+}
+
+func TestEnvVars(t *testing.T) {
+	vars := map[string]EnvVar{}
+	for _, v := range EnvVars() {
+		vars[v.Name] = v
+	}
+
+	assert.Equal(t, EnvVar{Name: "REDIS_ADDR", Path: "redis.addr", Type: "string", Default: "localhost:6379"}, vars["REDIS_ADDR"])
+	assert.Equal(t, EnvVar{Name: "SERVER_READ_TIMEOUT", Path: "server.read_timeout", Type: "duration", Default: "30s"}, vars["SERVER_READ_TIMEOUT"])
+	assert.Equal(t, EnvVar{Name: "JWT_SECRET_KEY", Path: "jwt.secret_key", Type: "string", Default: RedactedValue, Secret: true}, vars["JWT_SECRET_KEY"])
+	assert.NotContains(t, vars, "REDIS_REDIS_ADDR")
+}
+
+func TestResolveConfigPath_RepoLayout(t *testing.T) {
+	// Copy the shipped config files into a temp dir laid out like the repository
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "configs", "app"), 0o755))
+	for _, name := range []string{"config_local.yaml", "config_local.json"} {
+		data, err := os.ReadFile(filepath.Join("..", "..", "configs", "app", name))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "configs", "app", name), data, 0o600))
+	}
+
+	t.Chdir(dir)
+	t.Setenv("CONFIG_PATH", "")
+
+	path := ResolveConfigPath(nil)
+	assert.Equal(t, filepath.Join("configs", "app", "config_local.yaml"), path)
+
+	cfg, err := NewLoader(Defaults(), File(path)).Load()
+	require.NoError(t, err)
+	assert.Equal(t, "console", cfg.Log.Format)
+
+	// A deployed config.yaml takes precedence over the local ones
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "configs", "app", "config.yaml"), []byte("server:\n  port: \"9000\"\n"), 0o600))
+	assert.Equal(t, filepath.Join("configs", "app", "config.yaml"), ResolveConfigPath(nil))
+}
+
+func TestLoader_LoadWithOrigins(t *testing.T) {
+	path := writeConfigFile(t, "config.json", `{"server": {"port": "9000"}}`, 0o600)
+
+	cfg, origins, err := NewLoader(
+		Defaults(),
+		File(path),
+		Env(map[string]string{"JWT_SECRET_KEY": "from-env"}),
+		Overrides{"server.host": "127.0.0.1"},
+	).LoadWithOrigins()
+	require.NoError(t, err)
+
+	assert.Equal(t, "default", origins["database.host"])
+	assert.Equal(t, "file", origins["server.port"])
+	assert.Equal(t, "env", origins["jwt.secret_key"])
+	assert.Equal(t, "flag", origins["server.host"])
+
+	annotated := Annotated(cfg, origins)
+	jwt := annotated["jwt"].(map[string]any)
+	assert.Equal(t, AnnotatedValue{Value: RedactedValue, Source: "env"}, jwt["secret_key"])
+	assert.Equal(t, AnnotatedValue{Value: "15m0s", Source: "default"}, jwt["access_token_ttl"])
+}
+
+func TestLoader_LoadWithOrigins_Invalid(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", "server:\n  port: not-a-port\n", 0o600)
+	loader := NewLoader(Defaults(), File(path))
+
+	cfg, origins, err := loader.LoadWithOrigins()
+	assert.ErrorContains(t, err, "server.port: failed on the 'numeric' rule")
+	require.NotNil(t, cfg, "the merged config is returned along with the violations")
+	assert.Equal(t, "not-a-port", cfg.Server.Port)
+	assert.Equal(t, "file", origins["server.port"])
+
+	cfg, err = loader.Load()
+	assert.Error(t, err)
+	assert.Nil(t, cfg)
+}
+
+func TestValidateProductionDSN(t *testing.T) {
+	tests := []struct {
+		name    string
+		dsn     string
+		wantErr string
+	}{
+		{name: "url with require", dsn: "postgres://auth:secret@db:5432/auth?sslmode=require"},
+		{name: "url with verify-full", dsn: "postgresql://auth:secret@db/auth?connect_timeout=5&sslmode=verify-full"},
+		{name: "url encoded sslmode", dsn: "postgres://auth:secret@db/auth?ssl%6Dode=verify-ca"},
+		{name: "key value with require", dsn: "host=db user=auth password=secret sslmode=require"},
+		{name: "key value with spaces and quotes", dsn: "host=db password='a b\\'c' sslmode = 'verify-full'"},
+		{name: "url without sslmode", dsn: "postgres://auth:secret@db/auth", wantErr: "sslmode must be one of require, verify-ca, verify-full"},
+		{name: "url with prefer", dsn: "postgres://auth:secret@db/auth?sslmode=prefer", wantErr: "sslmode must be one of"},
+		{name: "url encoded disable", dsn: "postgres://auth:secret@db/auth?sslmode=%64isable", wantErr: "sslmode must be one of"},
+		{name: "key value with allow", dsn: "host=db sslmode=allow", wantErr: "sslmode must be one of"},
+		{name: "key value without sslmode", dsn: "host=db user=auth", wantErr: "sslmode must be one of"},
+		{name: "last sslmode wins", dsn: "sslmode=require host=db sslmode=disable", wantErr: "sslmode must be one of"},
+		{name: "sslmode inside a quoted value", dsn: "password='sslmode=require' host=db", wantErr: "sslmode must be one of"},
+		{name: "unterminated quote", dsn: "host=db password='secret sslmode=require", wantErr: "invalid dsn: unterminated quoted value"},
+		{name: "missing value separator", dsn: "host db", wantErr: "invalid dsn: expected key=value pairs"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := validateProductionDSN("database.dsn", tt.dsn)
+
+			if tt.wantErr == "" {
+				assert.Empty(t, violations)
+				return
+			}
+			require.Len(t, violations, 1)
+			assert.Contains(t, violations[0], "database.dsn: "+tt.wantErr)
+			assert.NotContains(t, violations[0], "secret")
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package config
+
+import "strings"
+
+// Origins maps config paths, e.g. "server.port", to the name of the source which set the value: default, file, env,
+// secret file or flag. A source setting the value it already had doesn't take over, and values left unset
+// by every source are absent.
+type Origins map[string]string
+
+// AnnotatedValue is a config value along with the source it came from
+type AnnotatedValue struct {
+	Value  any    `json:"value" yaml:"value"`
+	Source string `json:"source,omitempty" yaml:"source,omitempty"`
+}
+
+// Annotated returns cfg as nested maps mirroring its json structure, with every leaf being an AnnotatedValue.
+// Secret values are replaced by RedactedValue, so the result is safe to print.
+func Annotated(cfg *Config, origins Origins) map[string]any {
+	root := map[string]any{}
+
+	walkFields(cfg, func(f field) error {
+		node := root
+		parts := strings.Split(f.Path, ".")
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := node[part].(map[string]any)
+			if !ok {
+				child = map[string]any{}
+				node[part] = child
+			}
+			node = child
+		}
+
+		node[parts[len(parts)-1]] = AnnotatedValue{
+			Value:  printableValue(f),
+			Source: origins[f.Path],
+		}
+
+		return nil
+	})
+
+	return root
+}
+
+// printableValue returns the field value, formatting durations as strings and redacting secrets
+func printableValue(f field) any {
+	if f.Secret && !f.Value.IsZero() {
+		return RedactedValue
+	}
+
+	if _, ok := f.Value.Interface().(Duration); ok {
+		return formatValue(f.Value)
+	}
+
+	return f.Value.Interface()
+}
+
+// snapshotValues formats every leaf value of cfg, keyed by path
+func snapshotValues(cfg *Config) map[string]string {
+	values := map[string]string{}
+
+	walkFields(cfg, func(f field) error {
+		values[f.Path] = formatValue(f.Value)
+		return nil
+	})
+
+	return values
+}
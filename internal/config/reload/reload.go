@@ -0,0 +1,185 @@
+package reload
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/AtoyanMikhail/auth/internal/config"
+	"github.com/AtoyanMikhail/auth/internal/logger"
+)
+
+// DefaultInterval is how often the config file is checked for changes
+const DefaultInterval = 5 * time.Second
+
+// Handler is called after a reload was applied. Handlers must not modify the configs.
+type Handler func(old, new *config.Config)
+
+// Reloader holds the current config and reloads its hot-reloadable settings on SIGHUP or when the config file changes.
+// Only the following settings are reloaded, the rest require a restart:
+//   - jwt.access_token_ttl and jwt.refresh_token_ttl, applied to the tokens issued next;
+//   - log.level, applied by the SetLogLevel handler;
+//   - the lockout section;
+//   - the webhook section.
+//
+// Components read these settings from Current on every use, or get notified by OnReload.
+type Reloader struct {
+	loader   *config.Loader
+	path     string
+	interval time.Duration
+	l        logger.Logger
+
+	current  atomic.Pointer[config.Config]
+	mu       sync.Mutex
+	handlers []Handler
+}
+
+// New creates a reloader starting from the initial config. Each reload builds a fresh config with the loader,
+// so the loader should use the same sources as the initial config. path is the config file to watch and may be empty.
+func New(loader *config.Loader, initial *config.Config, path string, l logger.Logger) *Reloader {
+	r := &Reloader{
+		loader:   loader,
+		path:     path,
+		interval: DefaultInterval,
+		l:        l,
+	}
+	r.current.Store(initial)
+
+	return r
+}
+
+// Current returns the current config. The returned config must not be modified.
+func (r *Reloader) Current() *config.Config {
+	return r.current.Load()
+}
+
+// OnReload registers a handler called after every applied reload
+func (r *Reloader) OnReload(h Handler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.handlers = append(r.handlers, h)
+}
+
+// Reload loads and validates a new config and swaps in its hot-reloadable settings.
+// If the new config is invalid, the current one is kept and the error is returned.
+func (r *Reloader) Reload(trigger string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	loaded, err := r.loader.Load()
+	if err != nil {
+		r.l.Error("Config reload rejected",
+			logger.String("trigger", trigger),
+			logger.Error(err))
+		return fmt.Errorf("failed to reload config: %w", err)
+	}
+
+	old := r.current.Load()
+	next := *old
+	applyReloadable(&next, loaded)
+
+	changed := changedSettings(old, &next)
+	if len(changed) == 0 {
+		r.l.Info("Config reloaded, nothing changed", logger.String("trigger", trigger))
+		return nil
+	}
+
+	r.current.Store(&next)
+	for _, h := range r.handlers {
+		h(old, &next)
+	}
+
+	r.l.Info("Config reloaded",
+		logger.String("trigger", trigger),
+		logger.Any("changed", changed))
+
+	return nil
+}
+
+// Run reloads the config on SIGHUP and when the watched file changes, until ctx is done
+func (r *Reloader) Run(ctx context.Context) error {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	lastState := r.fileState()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-sighup:
+			_ = r.Reload("sighup")
+		case <-ticker.C:
+			state := r.fileState()
+			if state == lastState {
+				continue
+			}
+			lastState = state
+			_ = r.Reload("file")
+		}
+	}
+}
+
+// fileState identifies the version of the watched file. Comparing the modification time and size
+// also catches Kubernetes ConfigMap updates, which atomically swap a symlink.
+func (r *Reloader) fileState() string {
+	if r.path == "" {
+		return ""
+	}
+
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return "missing"
+	}
+
+	return fmt.Sprintf("%d:%d", info.ModTime().UnixNano(), info.Size())
+}
+
+// applyReloadable copies the hot-reloadable settings from src to dst
+func applyReloadable(dst, src *config.Config) {
+	dst.JWT.AccessTokenTTL = src.JWT.AccessTokenTTL
+	dst.JWT.RefreshTokenTTL = src.JWT.RefreshTokenTTL
+	dst.Log.Level = src.Log.Level
+	dst.Lockout = src.Lockout
+	dst.Webhook = src.Webhook
+}
+
+// changedSettings returns the names of the hot-reloadable settings which differ between old and new
+func changedSettings(old, new *config.Config) []string {
+	var changed []string
+
+	if old.JWT.AccessTokenTTL != new.JWT.AccessTokenTTL {
+		changed = append(changed, "jwt.access_token_ttl")
+	}
+	if old.JWT.RefreshTokenTTL != new.JWT.RefreshTokenTTL {
+		changed = append(changed, "jwt.refresh_token_ttl")
+	}
+	if old.Log.Level != new.Log.Level {
+		changed = append(changed, "log.level")
+	}
+	if old.Lockout != new.Lockout {
+		changed = append(changed, "lockout")
+	}
+	if old.Webhook != new.Webhook {
+		changed = append(changed, "webhook")
+	}
+
+	return changed
+}
+
+// SetLogLevel returns a handler applying log.level to the sinks of l which don't have their own level
+func SetLogLevel(l logger.Logger) Handler {
+	return func(old, new *config.Config) {
+		_ = logger.ApplyConfigLevels(l, new.Log)
+	}
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+)
+
+const (
+	// FileEnvSuffix is appended to the env name of a secret field to read its value from a file, e.g. JWT_SECRET_KEY_FILE
+	FileEnvSuffix = "_FILE"
+	// FileRefPrefix marks a secret value as a reference to a file, e.g. "file:///run/secrets/jwt_secret"
+	FileRefPrefix = "file://"
+	// RedactedValue replaces secret values in output
+	RedactedValue = "<redacted>"
+
+	maxSecretFileSize = 64 << 10
+)
+
+// loadSecrets resolves fields tagged with secret:"true" from mounted files (Docker/Kubernetes secrets).
+// For every secret field:
+//   - if <ENV>_FILE is set (e.g. DB_PASSWORD_FILE=/run/secrets/db_password), the value is read from that file;
+//   - otherwise, if the value loaded so far starts with file://, the value is read from the referenced path.
+//
+// Trailing newlines are trimmed. See readSecretFile for the permission checks.
+func loadSecrets(cfg *Config, lookup func(key string) (string, bool)) error {
+	var errs []error
+
+	err := walkFields(cfg, func(f field) error {
+		if !f.Secret || f.Value.Kind() != reflect.String {
+			return nil
+		}
+
+		var path string
+		if f.Env != "" {
+			path, _ = lookup(f.Env + FileEnvSuffix)
+		}
+		if path == "" {
+			ref, ok := strings.CutPrefix(f.Value.String(), FileRefPrefix)
+			if !ok {
+				return nil
+			}
+			path = ref
+		}
+
+		secret, err := readSecretFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.Path, err))
+			return nil
+		}
+		f.Value.SetString(secret)
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return errors.Join(errs...)
+}
+
+// readSecretFile reads a secret from path. The file must be a regular file (symlinks are followed, as used by
+// Kubernetes secret volumes), must not be writable by group or others and must not be larger than 64 KiB.
+func readSecretFile(path string) (string, error) {
+	if path == "" {
+		return "", errors.New("empty secret file path")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open secret file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to stat secret file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("secret file %s is not a regular file", path)
+	}
+	if perm := info.Mode().Perm(); perm&0o022 != 0 {
+		return "", fmt.Errorf("secret file %s has insecure permissions %#o: it must not be writable by group or others", path, perm)
+	}
+	if info.Size() > maxSecretFileSize {
+		return "", fmt.Errorf("secret file %s is larger than %d bytes", path, maxSecretFileSize)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSecretFileSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	if len(data) > maxSecretFileSize {
+		return "", fmt.Errorf("secret file %s is larger than %d bytes", path, maxSecretFileSize)
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
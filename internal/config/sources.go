@@ -0,0 +1,258 @@
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/caarlos0/env/v10"
+	"gopkg.in/yaml.v3"
+)
+
+// Source applies config values on top of the values loaded by the previous sources
+type Source interface {
+	// Name is used in error messages and reports where values came from
+	Name() string
+	Load(cfg *Config) error
+}
+
+type defaultsSource struct{}
+
+// Defaults returns a source setting the default values of every section
+func Defaults() Source {
+	return defaultsSource{}
+}
+
+func (defaultsSource) Name() string { return "default" }
+
+func (defaultsSource) Load(cfg *Config) error {
+	setDefaults(cfg)
+	return nil
+}
+
+type fileSource struct {
+	path  string
+	dirs  []string
+	names []string
+}
+
+// File returns a source decoding the config file at path. The file must exist.
+// The format is selected by the file extension: .json, .yaml/.yml or .toml.
+func File(path string) Source {
+	return &fileSource{path: path}
+}
+
+// SearchFile returns a source decoding the first existing file named one of names in one of dirs.
+// The source is skipped if no file is found.
+func SearchFile(dirs, names []string) Source {
+	return &fileSource{dirs: dirs, names: names}
+}
+
+func (s *fileSource) Name() string { return "file" }
+
+func (s *fileSource) Load(cfg *Config) error {
+	path := s.path
+	if path == "" {
+		path = findConfigFile(s.dirs, s.names)
+		if path == "" {
+			return nil
+		}
+	}
+
+	decode, err := decoderFor(path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := decode(file, cfg); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// decoderFor returns a decoder matching the extension of the config file
+func decoderFor(path string) (func(r io.Reader, cfg *Config) error, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return func(r io.Reader, cfg *Config) error {
+			return json.NewDecoder(r).Decode(cfg)
+		}, nil
+	case ".yaml", ".yml":
+		return func(r io.Reader, cfg *Config) error {
+			err := yaml.NewDecoder(r).Decode(cfg)
+			if errors.Is(err, io.EOF) {
+				// empty yaml document
+				return nil
+			}
+			return err
+		}, nil
+	case ".toml":
+		return func(r io.Reader, cfg *Config) error {
+			_, err := toml.NewDecoder(r).Decode(cfg)
+			return err
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported config file extension: %q", filepath.Ext(path))
+	}
+}
+
+type envSource struct {
+	environ map[string]string
+}
+
+// Env returns a source reading environment variables named after the env and envPrefix struct tags.
+// If environ is nil, the process environment is used.
+func Env(environ map[string]string) Source {
+	return &envSource{environ: environ}
+}
+
+func (s *envSource) Name() string { return "env" }
+
+func (s *envSource) Load(cfg *Config) error {
+	if s.environ == nil {
+		return env.Parse(cfg)
+	}
+	return env.ParseWithOptions(cfg, env.Options{Environment: s.environ})
+}
+
+type secretFilesSource struct {
+	environ map[string]string
+}
+
+// SecretFiles returns a source resolving secret fields from mounted files (see loadSecrets).
+// If environ is nil, the process environment is used to look up *_FILE variables.
+func SecretFiles(environ map[string]string) Source {
+	return &secretFilesSource{environ: environ}
+}
+
+func (s *secretFilesSource) Name() string { return "secret file" }
+
+func (s *secretFilesSource) Load(cfg *Config) error {
+	return loadSecrets(cfg, lookupFunc(s.environ))
+}
+
+// Overrides maps config paths to raw values, e.g. "server.port" to "9090". It is both a Source and the
+// flag.Value of the repeatable --set flag.
+type Overrides map[string]string
+
+func (o Overrides) Name() string { return "flag" }
+
+func (o Overrides) Load(cfg *Config) error {
+	var errs []error
+
+	known := map[string]bool{}
+	err := walkFields(cfg, func(f field) error {
+		known[f.Path] = true
+
+		raw, ok := o[f.Path]
+		if !ok {
+			return nil
+		}
+		if err := setField(f, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.Path, err))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range o.paths() {
+		if !known[path] {
+			errs = append(errs, fmt.Errorf("unknown config path %q", path))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (o Overrides) String() string {
+	pairs := make([]string, 0, len(o))
+	for _, path := range o.paths() {
+		pairs = append(pairs, path+"="+o[path])
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (o Overrides) Set(s string) error {
+	path, value, err := splitOverride(s)
+	if err != nil {
+		return err
+	}
+	o[path] = value
+	return nil
+}
+
+func (o Overrides) paths() []string {
+	paths := make([]string, 0, len(o))
+	for path := range o {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// setField parses raw into the field according to its type
+func setField(f field, raw string) error {
+	if u, ok := f.Value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(raw))
+	}
+
+	switch f.Value.Kind() {
+	case reflect.String:
+		f.Value.SetString(raw)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, f.Value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.Value.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, f.Value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.Value.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(raw, f.Value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.Value.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		f.Value.SetBool(b)
+	case reflect.Slice:
+		if f.Value.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", f.Value.Type())
+		}
+		var items []string
+		if raw != "" {
+			items = strings.Split(raw, ",")
+		}
+		f.Value.Set(reflect.ValueOf(items).Convert(f.Value.Type()))
+	default:
+		return fmt.Errorf("unsupported type %s", f.Value.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// minSecretKeyLength is the minimal length of the HMAC key in production: HS256 needs at least 256 bits
+const minSecretKeyLength = 32
+
+// knownDefaultSecrets are the values shipped by setDefaults and the example configs, which must never reach production
+var knownDefaultSecrets = []string{"secret_key", "password", "secret", "changeme", "postgres"}
+
+// ValidationError lists every violation found in the config
+type ValidationError struct {
+	Violations []string
+}
+
+func (e *ValidationError) Error() string {
+	return "config validation failed:\n  - " + strings.Join(e.Violations, "\n  - ")
+}
+
+func validate(cfg *Config) error {
+	validate := validator.New()
+
+	// Reporting fields by their json names, e.g. "database.ssl_mode"
+	validate.RegisterTagNameFunc(func(sf reflect.StructField) string {
+		return strings.Split(sf.Tag.Get("json"), ",")[0]
+	})
+
+	// Custom validation for Duration type: must be greater than 0
+	validate.RegisterValidation("duration_gt0", func(fl validator.FieldLevel) bool {
+		d, ok := fl.Field().Interface().(Duration)
+		return ok && d > 0
+	})
+
+	var violations []string
+
+	err := validate.Struct(cfg)
+	var validationErrs validator.ValidationErrors
+	switch {
+	case errors.As(err, &validationErrs):
+		for _, fe := range validationErrs {
+			violations = append(violations, describeFieldError(fe))
+		}
+	case err != nil:
+		return err
+	}
+
+	violations = append(violations, validateRules(cfg)...)
+
+	if cfg.Environment == EnvProd {
+		violations = append(violations, validateProduction(cfg)...)
+	}
+
+	if len(violations) > 0 {
+		return &ValidationError{Violations: violations}
+	}
+
+	return nil
+}
+
+// validateRules returns the violations of the rules spanning several fields
+func validateRules(cfg *Config) []string {
+	var violations []string
+
+	redaction := cfg.Log.Redaction
+	if redaction.HashKey == "" && (redaction.GDPR || len(redaction.HashKeys) > 0) {
+		violations = append(violations, "log.redaction.hash_key: must be set when gdpr or hash_keys are enabled")
+	}
+	if cfg.Redis.Mode == RedisCluster && cfg.Redis.DB != 0 {
+		violations = append(violations, "redis.db: must be 0 in cluster mode")
+	}
+
+	return violations
+}
+
+// validateProduction returns the violations of the production rules: no default secrets, strong HMAC keys,
+// TLS to Postgres and an authenticated Redis.
+func validateProduction(cfg *Config) []string {
+	var violations []string
+
+	if isKnownDefaultSecret(cfg.JWT.SecretKey) {
+		violations = append(violations, "jwt.secret_key: the default secret key is not allowed in prod")
+	}
+	if len(cfg.JWT.SecretKey) < minSecretKeyLength {
+		violations = append(violations, fmt.Sprintf("jwt.secret_key: must be at least %d bytes long in prod", minSecretKeyLength))
+	}
+	if isKnownDefaultSecret(cfg.TokenHash.Pepper) {
+		violations = append(violations, "token_hash.pepper: the default pepper is not allowed in prod")
+	}
+	if len(cfg.TokenHash.Pepper) < minSecretKeyLength {
+		violations = append(violations, fmt.Sprintf("token_hash.pepper: must be at least %d bytes long in prod", minSecretKeyLength))
+	}
+	if cfg.Database.DSN != "" {
+		violations = append(violations, validateProductionDSN("database.dsn", cfg.Database.DSN)...)
+	} else {
+		if isKnownDefaultSecret(cfg.Database.Password) {
+			violations = append(violations, "database.password: the default password is not allowed in prod")
+		}
+		if cfg.Database.SSLMode == "disable" {
+			violations = append(violations, "database.ssl_mode: \"disable\" is not allowed in prod")
+		}
+	}
+	for i, dsn := range cfg.Database.ReplicaDSNs {
+		violations = append(violations, validateProductionDSN(fmt.Sprintf("database.replica_dsns[%d]", i), dsn)...)
+	}
+	if cfg.Redis.Password == "" {
+		violations = append(violations, "redis.password: must be set in prod")
+	}
+	if cfg.Redis.TLS.InsecureSkipVerify {
+		violations = append(violations, "redis.tls.insecure_skip_verify: is not allowed in prod")
+	}
+
+	return violations
+}
+
+// validateProductionDSN requires an explicit sslmode enforcing TLS, as libpq defaults to prefer,
+// which silently falls back to plain text
+func validateProductionDSN(path, dsn string) []string {
+	mode, err := dsnSSLMode(dsn)
+	if err != nil {
+		return []string{fmt.Sprintf("%s: %s", path, err.Error())}
+	}
+	if !slices.Contains(secureSSLModes, mode) {
+		return []string{fmt.Sprintf("%s: sslmode must be one of %s in prod", path, strings.Join(secureSSLModes, ", "))}
+	}
+	return nil
+}
+
+func isKnownDefaultSecret(value string) bool {
+	for _, secret := range knownDefaultSecrets {
+		if strings.EqualFold(value, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+func describeFieldError(fe validator.FieldError) string {
+	// Namespace looks like "Config.database.ssl_mode"
+	path := fe.Namespace()
+	if _, rest, ok := strings.Cut(path, "."); ok {
+		path = rest
+	}
+
+	rule := fe.Tag()
+	if fe.Param() != "" {
+		rule += "=" + fe.Param()
+	}
+
+	return fmt.Sprintf("%s: failed on the '%s' rule", path, rule)
+}
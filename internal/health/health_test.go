@@ -0,0 +1,101 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecker_ReadinessHandler(t *testing.T) {
+	ok := func(ctx context.Context) error { return nil }
+	failing := func(ctx context.Context) error { return errors.New("connection refused") }
+	slow := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tests := []struct {
+		name       string
+		checks     map[string]Check
+		shutdown   bool
+		wantStatus int
+		wantReport func(t *testing.T, report Report)
+	}{
+		{
+			name:       "all dependencies ok",
+			checks:     map[string]Check{"postgres": ok, "redis": ok},
+			wantStatus: http.StatusOK,
+			wantReport: func(t *testing.T, report Report) {
+				assert.Equal(t, StatusOK, report.Status)
+				assert.Equal(t, StatusOK, report.Checks["postgres"].Status)
+				assert.Equal(t, StatusOK, report.Checks["redis"].Status)
+			},
+		},
+		{
+			name:       "failing dependency",
+			checks:     map[string]Check{"postgres": ok, "redis": failing},
+			wantStatus: http.StatusServiceUnavailable,
+			wantReport: func(t *testing.T, report Report) {
+				assert.Equal(t, StatusUnavailable, report.Status)
+				assert.Equal(t, StatusOK, report.Checks["postgres"].Status)
+				assert.Equal(t, CheckResult{Status: StatusUnavailable, LatencyMS: report.Checks["redis"].LatencyMS, Error: "connection refused"}, report.Checks["redis"])
+			},
+		},
+		{
+			name:       "check timing out",
+			checks:     map[string]Check{"postgres": slow},
+			wantStatus: http.StatusServiceUnavailable,
+			wantReport: func(t *testing.T, report Report) {
+				assert.Equal(t, "context deadline exceeded", report.Checks["postgres"].Error)
+			},
+		},
+		{
+			name:       "shutting down",
+			checks:     map[string]Check{"postgres": ok},
+			shutdown:   true,
+			wantStatus: http.StatusServiceUnavailable,
+			wantReport: func(t *testing.T, report Report) {
+				assert.Equal(t, StatusShuttingDown, report.Status)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChecker(50 * time.Millisecond)
+			for name, check := range tt.checks {
+				c.Add(name, check)
+			}
+			if tt.shutdown {
+				c.Shutdown()
+			}
+
+			rec := httptest.NewRecorder()
+			c.ReadinessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			var report Report
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&report))
+			tt.wantReport(t, report)
+		})
+	}
+}
+
+func TestChecker_LivenessHandler(t *testing.T) {
+	c := NewChecker(time.Second)
+	c.Add("postgres", func(ctx context.Context) error { return errors.New("down") })
+	c.Shutdown()
+
+	rec := httptest.NewRecorder()
+	c.LivenessHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, rec.Body.String())
+}
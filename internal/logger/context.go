@@ -0,0 +1,26 @@
+package logger
+
+import "context"
+
+type contextKey struct{}
+
+// WithContext returns a copy of ctx carrying l. Loggers carried by contexts usually have request scoped fields
+// such as request_id and trace_id, see the middleware package.
+func WithContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, l)
+}
+
+// FromContext returns the logger carried by ctx, or the global logger if there is none
+func FromContext(ctx context.Context) Logger {
+	return FromContextOr(ctx, Global())
+}
+
+// FromContextOr returns the logger carried by ctx, or fallback if there is none
+func FromContextOr(ctx context.Context, fallback Logger) Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(contextKey{}).(Logger); ok {
+			return l
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,50 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := NewWithSinks(Sink{Name: "test", Writer: &buf, Level: DebugLevel})
+	require.NoError(t, err)
+	fallback := New(&bytes.Buffer{})
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want Logger
+	}{
+		{name: "logger in context", ctx: WithContext(context.Background(), l), want: l},
+		{name: "no logger", ctx: context.Background(), want: fallback},
+		{name: "nil context", ctx: nil, want: fallback},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Same(t, tt.want, FromContextOr(tt.ctx, fallback))
+		})
+	}
+
+	assert.Same(t, Global(), FromContext(context.Background()))
+}
+
+func TestFromContext_CarriesFields(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := NewWithSinks(Sink{Name: "test", Writer: &buf, Level: DebugLevel})
+	require.NoError(t, err)
+
+	ctx := WithContext(context.Background(), l.With(String("request_id", "req-123")))
+	FromContext(ctx).Info("Refresh token created", String("user_id", "user-1"))
+
+	entry := map[string]any{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "req-123", entry["request_id"])
+	assert.Equal(t, "user-1", entry["user_id"])
+}
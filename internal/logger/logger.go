@@ -1,6 +1,10 @@
 package logger
 
-import "sync"
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
 
 // Level represents a level of logging. If the level set in the logger is higher than it,
 // the message will not be logged.
@@ -15,6 +19,70 @@ const (
 	FatalLevel
 )
 
+// ParseLevel converts a level name such as "debug" or "warn" to a Level
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return DebugLevel, nil
+	case "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	case "panic":
+		return PanicLevel, nil
+	case "fatal":
+		return FatalLevel, nil
+	default:
+		return InfoLevel, fmt.Errorf("unknown log level: %q", s)
+	}
+}
+
+// String returns the lowercase name of the level, as accepted by ParseLevel
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	case ErrorLevel:
+		return "error"
+	case PanicLevel:
+		return "panic"
+	case FatalLevel:
+		return "fatal"
+	default:
+		return fmt.Sprintf("Level(%d)", int(l))
+	}
+}
+
+// MarshalText encodes the level by its name, e.g. in json
+func (l Level) MarshalText() ([]byte, error) {
+	if l < DebugLevel || l > FatalLevel {
+		return nil, fmt.Errorf("unknown log level: %d", int(l))
+	}
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText decodes the level from its name, e.g. in json
+func (l *Level) UnmarshalText(text []byte) error {
+	level, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// SinkLeveler is implemented by loggers able to report the levels of their sinks
+type SinkLeveler interface {
+	// Levels returns the levels of the sinks by name
+	Levels() map[string]Level
+}
+
 var (
 	globalLogger Logger
 	initOnce     sync.Once
@@ -29,7 +97,8 @@ type Logger interface {
 	Panic(msg string, fields ...Field)
 	With(fields ...Field) Logger
 	Sync() error
-	SetLevel(level Level)
+	// SetLevel sets the level of the named sinks, or of every sink if no names are given
+	SetLevel(level Level, sinks ...string)
 }
 
 // Field represents a json field in a log message
@@ -0,0 +1,158 @@
+package logger
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/AtoyanMikhail/auth/internal/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// MaskedValue replaces the values of masked fields
+	MaskedValue = "***"
+	// redactedToken replaces JWT and bearer token looking substrings
+	redactedToken = "[REDACTED_TOKEN]"
+)
+
+var (
+	// GDPRKeys are the field keys pseudonymized in GDPR mode
+	GDPRKeys = []string{"user_id", "ip", "ip_address"}
+
+	jwtPattern    = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+	bearerPattern = regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`)
+)
+
+// redactor rewrites sensitive fields of log entries
+type redactor struct {
+	mask         map[string]bool
+	hash         map[string]bool
+	hashKey      []byte
+	detectTokens bool
+}
+
+// newRedactor returns a redactor configured by cfg, or nil if cfg doesn't redact anything
+func newRedactor(cfg config.LogRedactionConfig) (*redactor, error) {
+	r := &redactor{
+		mask:         map[string]bool{},
+		hash:         map[string]bool{},
+		hashKey:      []byte(cfg.HashKey),
+		detectTokens: cfg.DetectTokens,
+	}
+
+	for _, key := range cfg.MaskKeys {
+		r.mask[strings.ToLower(key)] = true
+	}
+
+	hashKeys := cfg.HashKeys
+	if cfg.GDPR {
+		hashKeys = append(append([]string{}, hashKeys...), GDPRKeys...)
+	}
+	for _, key := range hashKeys {
+		r.hash[strings.ToLower(key)] = true
+	}
+
+	if len(r.hash) > 0 && len(r.hashKey) == 0 {
+		return nil, fmt.Errorf("log redaction hash key is required to hash fields")
+	}
+	if len(r.mask) == 0 && len(r.hash) == 0 && !r.detectTokens {
+		return nil, nil
+	}
+
+	return r, nil
+}
+
+// wrap returns a core redacting the entries written to core
+func (r *redactor) wrap(core zapcore.Core) zapcore.Core {
+	return &redactingCore{Core: core, r: r}
+}
+
+// pseudonymize returns a stable keyed hash of value, so that entries of the same user or IP address
+// can be correlated without revealing it
+func (r *redactor) pseudonymize(value string) string {
+	mac := hmac.New(sha256.New, r.hashKey)
+	mac.Write([]byte(value))
+	return "h:" + hex.EncodeToString(mac.Sum(nil)[:12])
+}
+
+func (r *redactor) text(s string) string {
+	if !r.detectTokens {
+		return s
+	}
+	s = jwtPattern.ReplaceAllString(s, redactedToken)
+	return bearerPattern.ReplaceAllString(s, "${1}"+redactedToken)
+}
+
+func (r *redactor) fields(fields []zapcore.Field) []zapcore.Field {
+	var redacted []zapcore.Field
+	for i, f := range fields {
+		nf, changed := r.field(f)
+		if !changed {
+			continue
+		}
+		if redacted == nil {
+			// copy on first change, the caller owns fields
+			redacted = append([]zapcore.Field{}, fields...)
+		}
+		redacted[i] = nf
+	}
+
+	if redacted == nil {
+		return fields
+	}
+	return redacted
+}
+
+func (r *redactor) field(f zapcore.Field) (zapcore.Field, bool) {
+	key := strings.ToLower(f.Key)
+
+	switch {
+	case r.mask[key]:
+		return zap.String(f.Key, MaskedValue), true
+	case r.hash[key]:
+		return zap.String(f.Key, r.pseudonymize(fieldValue(f))), true
+	case f.Type == zapcore.StringType && r.detectTokens:
+		redacted := r.text(f.String)
+		return zap.String(f.Key, redacted), redacted != f.String
+	default:
+		return f, false
+	}
+}
+
+// fieldValue formats the value of any field as a string
+func fieldValue(f zapcore.Field) string {
+	if f.Type == zapcore.StringType {
+		return f.String
+	}
+
+	enc := zapcore.NewMapObjectEncoder()
+	f.AddTo(enc)
+	return fmt.Sprint(enc.Fields[f.Key])
+}
+
+// redactingCore redacts the message and fields of entries before passing them to the wrapped core
+type redactingCore struct {
+	zapcore.Core
+	r *redactor
+}
+
+func (c *redactingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &redactingCore{Core: c.Core.With(c.r.fields(fields)), r: c.r}
+}
+
+func (c *redactingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *redactingCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	ent.Message = c.r.text(ent.Message)
+	return c.Core.Write(ent, c.r.fields(fields))
+}
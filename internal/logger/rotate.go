@@ -0,0 +1,32 @@
+package logger
+
+import (
+	"io"
+
+	"github.com/AtoyanMikhail/auth/internal/config"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// NewRotatingFile returns a writer appending to the file at path and rotating it by size and age as set in cfg.
+// Rotated files are named after the original one with a timestamp, e.g. auth-2025-01-02T15-04-05.000.log,
+// and optionally gzipped. The writer can be passed to New as one of the tee'd outputs.
+func NewRotatingFile(path string, cfg config.LogRotationConfig) io.WriteCloser {
+	return &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    cfg.MaxSizeMB,
+		MaxAge:     cfg.MaxAgeDays,
+		MaxBackups: cfg.MaxBackups,
+		Compress:   cfg.Compress,
+	}
+}
+
+// rotatingFiles returns the rotating files among the writers of sinks
+func rotatingFiles(sinks []Sink) []io.Closer {
+	var files []io.Closer
+	for _, sink := range sinks {
+		if file, ok := sink.Writer.(*lumberjack.Logger); ok {
+			files = append(files, file)
+		}
+	}
+	return files
+}
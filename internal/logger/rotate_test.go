@@ -0,0 +1,143 @@
+package logger
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AtoyanMikhail/auth/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRotatingFile_RotatesOnSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "auth.log")
+
+	w := NewRotatingFile(path, config.LogRotationConfig{Enabled: true, MaxSizeMB: 1, MaxBackups: 5})
+	defer w.Close()
+
+	// Rotated files are named after the time in milliseconds, so a single rotation is triggered
+	chunk := bytes.Repeat([]byte("x"), 600<<10)
+	for i := 0; i < 2; i++ {
+		_, err := w.Write(chunk)
+		require.NoError(t, err)
+	}
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 2, "the current file and the rotated one")
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(chunk)), info.Size())
+}
+
+func TestLogger_Close(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.log")
+	l, err := NewFromConfig(config.LogConfig{
+		Level:      "info",
+		Format:     "json",
+		Outputs:    []string{path, "stdout"},
+		TimeFormat: "iso8601",
+		Rotation:   config.LogRotationConfig{Enabled: true, MaxSizeMB: 1},
+	})
+	require.NoError(t, err)
+
+	closer, ok := l.(io.Closer)
+	require.True(t, ok)
+	assert.Len(t, l.(*loggerImpl).closers, 1, "only the rotating file is closed")
+
+	l.Info("before close")
+	require.NoError(t, closer.Close())
+	// Entries logged during the rest of the shutdown reopen the file
+	l.With(String("phase", "shutdown")).Info("after close")
+	require.NoError(t, closer.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "before close")
+	assert.Contains(t, string(data), "after close")
+}
+
+func TestLogger_Close_PlainFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.log")
+	l, err := NewFromConfig(config.LogConfig{
+		Level:      "info",
+		Format:     "json",
+		Outputs:    []string{path, "stderr"},
+		TimeFormat: "iso8601",
+	})
+	require.NoError(t, err)
+	require.Len(t, l.(*loggerImpl).closers, 1, "the file is closed, stderr is not")
+
+	l.Info("before close")
+	closer := l.(io.Closer)
+	require.NoError(t, closer.Close())
+	require.NoError(t, closer.Close(), "closing twice is not an error")
+
+	_, err = l.(*loggerImpl).closers[0].(*os.File).Write([]byte("x"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "before close")
+}
+
+func TestNewFromConfig_ClosesFilesOnError(t *testing.T) {
+	if _, err := os.ReadDir("/proc/self/fd"); err != nil {
+		t.Skip("open files can't be counted:", err)
+	}
+	openFiles := func() int {
+		entries, err := os.ReadDir("/proc/self/fd")
+		require.NoError(t, err)
+		return len(entries)
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(cfg *config.LogConfig)
+		wantErr string
+	}{
+		{
+			name: "invalid sink level",
+			modify: func(cfg *config.LogConfig) {
+				cfg.Sinks = []config.LogSinkConfig{{Name: "bad", Output: "stderr", Level: "verbose"}}
+			},
+			wantErr: "verbose",
+		},
+		{
+			name:    "invalid stacktrace level",
+			modify:  func(cfg *config.LogConfig) { cfg.StacktraceLevel = "verbose" },
+			wantErr: "verbose",
+		},
+		{
+			name: "duplicate sink name",
+			modify: func(cfg *config.LogConfig) {
+				cfg.Sinks = []config.LogSinkConfig{{Name: "stderr", Output: "stderr"}}
+			},
+			wantErr: "duplicate log sink name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := config.LogConfig{
+				Level:      "info",
+				Format:     "json",
+				Outputs:    []string{filepath.Join(dir, "auth.log"), "stderr"},
+				TimeFormat: "iso8601",
+				Sinks:      []config.LogSinkConfig{{Name: "audit", Output: filepath.Join(dir, "audit.log")}},
+			}
+			tt.modify(&cfg)
+
+			before := openFiles()
+			_, err := NewFromConfig(cfg)
+			assert.ErrorContains(t, err, tt.wantErr)
+			assert.Equal(t, before, openFiles(), "the opened files are closed")
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/AtoyanMikhail/auth/internal/config"
+	"go.uber.org/zap/zapcore"
+)
+
+// droppedEntries counts the entries dropped by sampling in all loggers
+var droppedEntries atomic.Uint64
+
+// DroppedEntries returns the number of entries dropped by sampling since the process start. It is exported as a metric.
+func DroppedEntries() uint64 {
+	return droppedEntries.Load()
+}
+
+func countDropped(_ zapcore.Entry, decision zapcore.SamplingDecision) {
+	if decision&zapcore.LogDropped != 0 {
+		droppedEntries.Add(1)
+	}
+}
+
+// samplingCore routes entries to the sampler of their message if there is a rule for it,
+// to the default sampler if their level is sampled, and straight to the wrapped core otherwise
+type samplingCore struct {
+	zapcore.Core
+	sampled  zapcore.Core
+	levels   map[zapcore.Level]bool
+	messages map[string]zapcore.Core
+}
+
+// newSampling returns a wrapper sampling entries as configured by cfg, or nil if sampling is disabled
+func newSampling(cfg config.LogSamplingConfig) (coreWrapper, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	levels := map[zapcore.Level]bool{}
+	for _, name := range cfg.Levels {
+		level, err := ParseLevel(name)
+		if err != nil {
+			return nil, err
+		}
+		levels[toZapLevel(level)] = true
+	}
+
+	tick := time.Duration(cfg.Tick)
+
+	return func(core zapcore.Core) zapcore.Core {
+		c := &samplingCore{
+			Core:     core,
+			sampled:  zapcore.NewSamplerWithOptions(core, tick, cfg.First, cfg.Thereafter, zapcore.SamplerHook(countDropped)),
+			levels:   levels,
+			messages: make(map[string]zapcore.Core, len(cfg.Rules)),
+		}
+		for _, rule := range cfg.Rules {
+			c.messages[rule.Message] = zapcore.NewSamplerWithOptions(core, tick, rule.First, rule.Thereafter, zapcore.SamplerHook(countDropped))
+		}
+		return c
+	}, nil
+}
+
+func (c *samplingCore) With(fields []zapcore.Field) zapcore.Core {
+	messages := make(map[string]zapcore.Core, len(c.messages))
+	for msg, core := range c.messages {
+		messages[msg] = core.With(fields)
+	}
+
+	return &samplingCore{
+		Core:     c.Core.With(fields),
+		sampled:  c.sampled.With(fields),
+		levels:   c.levels,
+		messages: messages,
+	}
+}
+
+func (c *samplingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if core, ok := c.messages[ent.Message]; ok {
+		return core.Check(ent, ce)
+	}
+	if c.levels[ent.Level] {
+		return c.sampled.Check(ent, ce)
+	}
+	return c.Core.Check(ent, ce)
+}
@@ -0,0 +1,41 @@
+package logger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AtoyanMikhail/auth/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampling(t *testing.T) {
+	l, newEntries := newTestLogger(t, func(cfg *config.LogConfig) {
+		cfg.Sampling = config.LogSamplingConfig{
+			Enabled:    true,
+			Tick:       config.Duration(time.Minute),
+			First:      2,
+			Thereafter: 0,
+			Levels:     []string{"info"},
+			Rules: []config.LogSamplingRule{
+				{Message: "IP attempt logged", First: 1, Thereafter: 5},
+			},
+		}
+	})
+	droppedBefore := DroppedEntries()
+
+	for i := 0; i < 10; i++ {
+		l.Info("Refresh token created")
+		l.Warn("Token not found for delete")
+		l.With(String("user_id", "user")).Info("IP attempt logged")
+	}
+
+	counts := map[string]int{}
+	for _, entry := range newEntries() {
+		counts[entry["msg"].(string)]++
+	}
+
+	assert.Equal(t, 2, counts["Refresh token created"], "sampled level")
+	assert.Equal(t, 10, counts["Token not found for delete"], "level not sampled")
+	assert.Equal(t, 2, counts["IP attempt logged"], "message rule: the 1st and the 6th entries")
+	assert.Equal(t, uint64(8+8), DroppedEntries()-droppedBefore)
+}
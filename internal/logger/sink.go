@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"io"
+
+	"github.com/AtoyanMikhail/auth/internal/config"
+)
+
+// Sink is a named output of the logger with its own minimal level and encoding
+type Sink struct {
+	// Name identifies the sink in SetLevel
+	Name   string
+	Writer io.Writer
+	Level  Level
+	// Format is json or console, json if empty
+	Format string
+	// TimeFormat is iso8601, rfc3339, rfc3339nano, epoch, epoch_millis or a Go time layout, iso8601 if empty
+	TimeFormat string
+}
+
+// sinkFromConfig opens the output of a configured sink, which inherits unset settings from cfg
+func sinkFromConfig(sc config.LogSinkConfig, cfg config.LogConfig) (Sink, error) {
+	levelName := sc.Level
+	if levelName == "" {
+		levelName = cfg.Level
+	}
+	level, err := ParseLevel(levelName)
+	if err != nil {
+		return Sink{}, err
+	}
+
+	w, err := openOutput(sc.Output, cfg.Rotation)
+	if err != nil {
+		return Sink{}, err
+	}
+
+	sink := Sink{
+		Name:       sc.Name,
+		Writer:     w,
+		Level:      level,
+		Format:     sc.Format,
+		TimeFormat: sc.TimeFormat,
+	}
+	if sink.Format == "" {
+		sink.Format = cfg.Format
+	}
+	if sink.TimeFormat == "" {
+		sink.TimeFormat = cfg.TimeFormat
+	}
+
+	return sink, nil
+}
+
+// ApplyConfigLevels sets the sink levels of l according to cfg: the outputs and the sinks without their own
+// level get cfg.Level, the other sinks get their own level
+func ApplyConfigLevels(l Logger, cfg config.LogConfig) error {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+	if len(cfg.Outputs) > 0 {
+		l.SetLevel(level, cfg.Outputs...)
+	}
+
+	for _, sc := range cfg.Sinks {
+		sinkLevel := level
+		if sc.Level != "" {
+			if sinkLevel, err = ParseLevel(sc.Level); err != nil {
+				return err
+			}
+		}
+		l.SetLevel(sinkLevel, sc.Name)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/AtoyanMikhail/auth/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test helper returning the messages of the json entries written to buf
+func messages(t *testing.T, buf *bytes.Buffer) []string {
+	var msgs []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		entry := map[string]any{}
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		msgs = append(msgs, entry["msg"].(string))
+	}
+	return msgs
+}
+
+func TestNewWithSinks_RoutesByLevel(t *testing.T) {
+	var app, errs bytes.Buffer
+	l, err := NewWithSinks(
+		Sink{Name: "app", Writer: &app, Level: InfoLevel},
+		Sink{Name: "errors", Writer: &errs, Level: ErrorLevel},
+	)
+	require.NoError(t, err)
+
+	l.Debug("debug entry")
+	l.Info("info entry")
+	l.Warn("warn entry")
+	l.Error("error entry")
+
+	assert.Equal(t, []string{"info entry", "warn entry", "error entry"}, messages(t, &app))
+	assert.Equal(t, []string{"error entry"}, messages(t, &errs))
+}
+
+func TestNewWithSinks_DuplicateName(t *testing.T) {
+	_, err := NewWithSinks(
+		Sink{Name: "app", Writer: &bytes.Buffer{}},
+		Sink{Name: "app", Writer: &bytes.Buffer{}},
+	)
+	assert.ErrorContains(t, err, "duplicate log sink name")
+}
+
+func TestSetLevel_PerSink(t *testing.T) {
+	var app, errs bytes.Buffer
+	l, err := NewWithSinks(
+		Sink{Name: "app", Writer: &app, Level: InfoLevel},
+		Sink{Name: "errors", Writer: &errs, Level: ErrorLevel},
+	)
+	require.NoError(t, err)
+	child := l.With(String("request_id", "req-1"))
+
+	// The level is shared with the children created by With
+	l.SetLevel(DebugLevel, "app")
+	child.Debug("debug entry")
+
+	assert.Equal(t, []string{"debug entry"}, messages(t, &app))
+	assert.Empty(t, messages(t, &errs))
+	assert.Equal(t, map[string]Level{"app": DebugLevel, "errors": ErrorLevel}, l.(SinkLeveler).Levels())
+
+	// Without names, every sink is set, unknown names are ignored
+	l.SetLevel(WarnLevel)
+	l.SetLevel(DebugLevel, "unknown")
+	assert.Equal(t, map[string]Level{"app": WarnLevel, "errors": WarnLevel}, l.(SinkLeveler).Levels())
+}
+
+func TestApplyConfigLevels(t *testing.T) {
+	l, err := NewWithSinks(
+		Sink{Name: "stdout", Writer: &bytes.Buffer{}, Level: InfoLevel},
+		Sink{Name: "audit", Writer: &bytes.Buffer{}, Level: InfoLevel},
+		Sink{Name: "debug", Writer: &bytes.Buffer{}, Level: InfoLevel},
+	)
+	require.NoError(t, err)
+
+	err = ApplyConfigLevels(l, config.LogConfig{
+		Level:   "warn",
+		Outputs: []string{"stdout"},
+		Sinks: []config.LogSinkConfig{
+			{Name: "audit"},
+			{Name: "debug", Level: "debug"},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]Level{"stdout": WarnLevel, "audit": WarnLevel, "debug": DebugLevel}, l.(SinkLeveler).Levels())
+}
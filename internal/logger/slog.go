@@ -0,0 +1,238 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"runtime"
+	"time"
+)
+
+// slog levels of PanicLevel and FatalLevel, which slog doesn't define
+const (
+	SlogLevelPanic = slog.Level(10)
+	SlogLevelFatal = slog.Level(12)
+)
+
+// levelEnabler is implemented by loggers able to tell whether a level is logged
+type levelEnabler interface {
+	Enabled(level Level) bool
+}
+
+// callerLogger is implemented by loggers able to log an entry with the caller at pc, rather than their own caller
+type callerLogger interface {
+	logWithCaller(level Level, pc uintptr, msg string, fields []Field)
+}
+
+// slogHandler is a slog.Handler writing records to a Logger
+type slogHandler struct {
+	l      Logger
+	fields []Field
+	group  string
+}
+
+// NewSlogHandler returns a slog.Handler writing to l, so that libraries logging with slog end up
+// in the same stream with the same fields. Groups are flattened into dotted keys, e.g. "http.status".
+// If the context passed to slog carries a logger (see WithContext), it is used instead of l.
+func NewSlogHandler(l Logger) slog.Handler {
+	return &slogHandler{l: l}
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	if e, ok := h.l.(levelEnabler); ok {
+		return e.Enabled(fromSlogLevel(level))
+	}
+	return true
+}
+
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	fields := make([]Field, 0, len(h.fields)+r.NumAttrs())
+	fields = append(fields, h.fields...)
+	r.Attrs(func(attr slog.Attr) bool {
+		fields = appendAttr(fields, h.group, attr)
+		return true
+	})
+
+	// slog can't panic or exit, so higher levels are logged as errors
+	level := min(fromSlogLevel(r.Level), ErrorLevel)
+
+	// The caller is the call to slog, not this handler
+	l := FromContextOr(ctx, h.l)
+	if cl, ok := l.(callerLogger); ok {
+		cl.logWithCaller(level, r.PC, r.Message, fields)
+		return nil
+	}
+
+	switch level {
+	case DebugLevel:
+		l.Debug(r.Message, fields...)
+	case InfoLevel:
+		l.Info(r.Message, fields...)
+	case WarnLevel:
+		l.Warn(r.Message, fields...)
+	default:
+		l.Error(r.Message, fields...)
+	}
+
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := append([]Field{}, h.fields...)
+	for _, attr := range attrs {
+		fields = appendAttr(fields, h.group, attr)
+	}
+	return &slogHandler{l: h.l, fields: fields, group: h.group}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &slogHandler{l: h.l, fields: h.fields, group: h.group + name + "."}
+}
+
+// appendAttr converts attr to fields, flattening groups into dotted keys
+func appendAttr(fields []Field, prefix string, attr slog.Attr) []Field {
+	attr.Value = attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return fields
+	}
+
+	if attr.Value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		if attr.Key != "" {
+			groupPrefix += attr.Key + "."
+		}
+		for _, a := range attr.Value.Group() {
+			fields = appendAttr(fields, groupPrefix, a)
+		}
+		return fields
+	}
+
+	value := attr.Value.Any()
+	if err, ok := value.(error); ok {
+		value = err.Error()
+	}
+
+	return append(fields, Field{Key: prefix + attr.Key, Value: value})
+}
+
+// slogLogger is a Logger writing to a slog.Handler
+type slogLogger struct {
+	h     slog.Handler
+	level *slog.LevelVar
+}
+
+// NewFromSlog returns a Logger writing to any slog.Handler, e.g. to swap zap out in tests.
+// The level starts at InfoLevel and is shared with the children created by With. Sinks are not supported:
+// SetLevel ignores sink names.
+func NewFromSlog(h slog.Handler) Logger {
+	level := &slog.LevelVar{}
+	level.Set(slog.LevelInfo)
+	return &slogLogger{h: h, level: level}
+}
+
+func (l *slogLogger) Debug(msg string, fields ...Field) { l.log(slog.LevelDebug, msg, fields) }
+func (l *slogLogger) Info(msg string, fields ...Field)  { l.log(slog.LevelInfo, msg, fields) }
+func (l *slogLogger) Warn(msg string, fields ...Field)  { l.log(slog.LevelWarn, msg, fields) }
+func (l *slogLogger) Error(msg string, fields ...Field) { l.log(slog.LevelError, msg, fields) }
+
+// Fatal logs a message at SlogLevelFatal and then calls os.Exit(1).
+func (l *slogLogger) Fatal(msg string, fields ...Field) {
+	l.log(SlogLevelFatal, msg, fields)
+	os.Exit(1)
+}
+
+// Panic logs a message at SlogLevelPanic and then panics.
+func (l *slogLogger) Panic(msg string, fields ...Field) {
+	l.log(SlogLevelPanic, msg, fields)
+	panic(msg)
+}
+
+func (l *slogLogger) With(fields ...Field) Logger {
+	return &slogLogger{h: l.h.WithAttrs(toSlogAttrs(fields)), level: l.level}
+}
+
+func (l *slogLogger) Sync() error {
+	return nil
+}
+
+func (l *slogLogger) SetLevel(level Level, sinks ...string) {
+	l.level.Set(toSlogLevel(level))
+}
+
+func (l *slogLogger) Levels() map[string]Level {
+	return map[string]Level{"slog": fromSlogLevel(l.level.Level())}
+}
+
+func (l *slogLogger) Enabled(level Level) bool {
+	return toSlogLevel(level) >= l.level.Level()
+}
+
+func (l *slogLogger) log(level slog.Level, msg string, fields []Field) {
+	// Skipping runtime.Callers, log and the exported method
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+
+	l.logAt(level, pcs[0], msg, fields)
+}
+
+func (l *slogLogger) logWithCaller(level Level, pc uintptr, msg string, fields []Field) {
+	l.logAt(toSlogLevel(level), pc, msg, fields)
+}
+
+func (l *slogLogger) logAt(level slog.Level, pc uintptr, msg string, fields []Field) {
+	ctx := context.Background()
+	if level < l.level.Level() || !l.h.Enabled(ctx, level) {
+		return
+	}
+
+	r := slog.NewRecord(time.Now(), level, msg, pc)
+	r.AddAttrs(toSlogAttrs(fields)...)
+	_ = l.h.Handle(ctx, r)
+}
+
+func toSlogAttrs(fields []Field) []slog.Attr {
+	attrs := make([]slog.Attr, len(fields))
+	for i, f := range fields {
+		attrs[i] = slog.Any(f.Key, f.Value)
+	}
+	return attrs
+}
+
+func toSlogLevel(level Level) slog.Level {
+	switch level {
+	case DebugLevel:
+		return slog.LevelDebug
+	case InfoLevel:
+		return slog.LevelInfo
+	case WarnLevel:
+		return slog.LevelWarn
+	case ErrorLevel:
+		return slog.LevelError
+	case PanicLevel:
+		return SlogLevelPanic
+	case FatalLevel:
+		return SlogLevelFatal
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func fromSlogLevel(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return DebugLevel
+	case level < slog.LevelWarn:
+		return InfoLevel
+	case level < slog.LevelError:
+		return WarnLevel
+	case level < SlogLevelPanic:
+		return ErrorLevel
+	case level < SlogLevelFatal:
+		return PanicLevel
+	default:
+		return FatalLevel
+	}
+}
@@ -0,0 +1,80 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/AtoyanMikhail/auth/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSlogHandler(t *testing.T) {
+	l, newEntries := newTestLogger(t, func(cfg *config.LogConfig) {
+		cfg.Level = "info"
+	})
+	s := slog.New(NewSlogHandler(l))
+
+	s.Debug("Not logged")
+	s.With("component", "pgx").WithGroup("conn").Warn("Slow query",
+		slog.Int("pid", 42),
+		slog.Group("query", slog.String("name", "select")),
+		slog.Any("err", errors.New("timeout")))
+
+	entry := lastEntry(t, newEntries)
+	assert.Equal(t, "warn", entry["level"])
+	assert.Equal(t, "Slow query", entry["msg"])
+	assert.Equal(t, "pgx", entry["component"])
+	assert.Equal(t, float64(42), entry["conn.pid"])
+	assert.Equal(t, "select", entry["conn.query.name"])
+	assert.Equal(t, "timeout", entry["conn.err"])
+}
+
+func TestNewFromSlog(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := NewFromSlog(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	l.Debug("Not logged")
+	l.SetLevel(DebugLevel)
+	l.With(String("request_id", "req-1")).Info("Refresh token created", Int("id", 7))
+
+	entry := map[string]any{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "INFO", entry["level"])
+	assert.Equal(t, "Refresh token created", entry["msg"])
+	assert.Equal(t, "req-1", entry["request_id"])
+	assert.Equal(t, float64(7), entry["id"])
+}
+
+func TestNewSlogHandler_Caller(t *testing.T) {
+	l, newEntries := newTestLogger(t, func(cfg *config.LogConfig) {
+		cfg.Caller = true
+	})
+
+	_, file, line, _ := runtime.Caller(0)
+	slog.New(NewSlogHandler(l)).Info("From a library")
+
+	entry := lastEntry(t, newEntries)
+	assert.Equal(t, fmt.Sprintf("logger/%s:%d", filepath.Base(file), line+1), entry["caller"])
+
+	buf := &bytes.Buffer{}
+	fromSlog := NewFromSlog(slog.NewJSONHandler(buf, &slog.HandlerOptions{AddSource: true}))
+	_, _, line, _ = runtime.Caller(0)
+	slog.New(NewSlogHandler(fromSlog)).Info("From a library")
+
+	var record struct {
+		Source struct {
+			File string `json:"file"`
+			Line int    `json:"line"`
+		} `json:"source"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, file, record.Source.File)
+	assert.Equal(t, line+1, record.Source.Line)
+}
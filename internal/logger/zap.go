@@ -1,48 +1,259 @@
 package logger
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"runtime"
 
+	"github.com/AtoyanMikhail/auth/internal/config"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
 type loggerImpl struct {
 	zapLogger *zap.Logger
-	level     zap.AtomicLevel
-	encoder   zapcore.Encoder
-	teedCore  zapcore.Core
+	// levels of the sinks by name, shared with the children created by With
+	levels   map[string]zap.AtomicLevel
+	teedCore zapcore.Core
+	// closers are the files of the sinks, closed by Close
+	closers []io.Closer
 }
 
 // New creates a new logger instance that writes logs to the provided io.Writer interfaces.
+// The writers are registered as sinks named "writer0", "writer1" and so on.
 func New(writers ...io.Writer) Logger {
 	// Конфигурация по умолчанию
-	level := zap.NewAtomicLevelAt(zap.InfoLevel)
-	encoderConfig := zap.NewProductionEncoderConfig()
-	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
-	encoder := zapcore.NewJSONEncoder(encoderConfig)
+	sinks := make([]Sink, len(writers))
+	for i, w := range writers {
+		sinks[i] = Sink{
+			Name:   fmt.Sprintf("writer%d", i),
+			Writer: w,
+			Level:  InfoLevel,
+		}
+	}
+
+	l, _ := newLogger(sinks, buildOptions{zapOptions: []zap.Option{zap.AddCaller()}, files: rotatingFiles(sinks)})
+	return l
+}
+
+// NewWithSinks creates a new logger instance writing every entry to the sinks whose level it satisfies
+func NewWithSinks(sinks ...Sink) (Logger, error) {
+	return newLogger(sinks, buildOptions{zapOptions: []zap.Option{zap.AddCaller()}, files: rotatingFiles(sinks)})
+}
+
+// NewFromConfig creates a new logger instance configured by cfg: level, json or console format, outputs,
+// sinks, caller, stacktrace level, time format, redaction and sampling. Every output becomes a sink named after the output
+// with the common level and format; sinks may override them. The files opened for the outputs are closed by Close
+// of the logger, or right away if the logger can't be created.
+func NewFromConfig(cfg config.LogConfig) (_ Logger, err error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []io.Closer
+	defer func() {
+		if err != nil {
+			closeFiles(files)
+		}
+	}()
+
+	sinks := make([]Sink, 0, len(cfg.Outputs)+len(cfg.Sinks))
+	for _, output := range cfg.Outputs {
+		w, err := openOutput(output, cfg.Rotation)
+		if err != nil {
+			return nil, err
+		}
+		files = appendFile(files, w)
+		sinks = append(sinks, Sink{
+			Name:       output,
+			Writer:     w,
+			Level:      level,
+			Format:     cfg.Format,
+			TimeFormat: cfg.TimeFormat,
+		})
+	}
+
+	for _, sc := range cfg.Sinks {
+		sink, err := sinkFromConfig(sc, cfg)
+		if err != nil {
+			return nil, err
+		}
+		files = appendFile(files, sink.Writer)
+		sinks = append(sinks, sink)
+	}
+
+	var opts []zap.Option
+	if cfg.Caller {
+		opts = append(opts, zap.AddCaller())
+	}
+	if cfg.StacktraceLevel != "" {
+		stacktraceLevel, err := ParseLevel(cfg.StacktraceLevel)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, zap.AddStacktrace(toZapLevel(stacktraceLevel)))
+	}
+
+	var build buildOptions
+	build.zapOptions = opts
+	build.files = files
+
+	redactor, err := newRedactor(cfg.Redaction)
+	if err != nil {
+		return nil, err
+	}
+	if redactor != nil {
+		build.sinkWrappers = append(build.sinkWrappers, redactor.wrap)
+	}
+
+	sampling, err := newSampling(cfg.Sampling)
+	if err != nil {
+		return nil, err
+	}
+	if sampling != nil {
+		build.rootWrappers = append(build.rootWrappers, sampling)
+	}
+
+	return newLogger(sinks, build)
+}
+
+// coreWrapper decorates a core, e.g. to redact or sample entries
+type coreWrapper func(zapcore.Core) zapcore.Core
+
+type buildOptions struct {
+	// sinkWrappers decorate the core of every sink
+	sinkWrappers []coreWrapper
+	// rootWrappers decorate the tee of the sink cores, so that entries are counted once for all sinks
+	rootWrappers []coreWrapper
+	zapOptions   []zap.Option
+	// files are closed by Close of the logger
+	files []io.Closer
+}
+
+func newLogger(sinks []Sink, build buildOptions) (Logger, error) {
+	levels := make(map[string]zap.AtomicLevel, len(sinks))
+	cores := make([]zapcore.Core, 0, len(sinks))
+	for _, sink := range sinks {
+		if _, ok := levels[sink.Name]; ok {
+			return nil, fmt.Errorf("duplicate log sink name: %q", sink.Name)
+		}
 
-	cores := make([]zapcore.Core, 0, len(writers))
-	for _, w := range writers {
-		core := zapcore.NewCore(
+		format := sink.Format
+		if format == "" {
+			format = "json"
+		}
+		encoder, err := newEncoder(format, sink.TimeFormat)
+		if err != nil {
+			return nil, err
+		}
+
+		level := zap.NewAtomicLevelAt(toZapLevel(sink.Level))
+		levels[sink.Name] = level
+
+		var core zapcore.Core = zapcore.NewCore(
 			encoder,
-			zapcore.AddSync(w),
+			zapcore.AddSync(sink.Writer),
 			level,
 		)
+		// Wrapping every sink core rather than the tee, as the tee writes to its cores regardless of their levels
+		for _, wrap := range build.sinkWrappers {
+			core = wrap(core)
+		}
 		cores = append(cores, core)
 	}
 
 	teedCore := zapcore.NewTee(cores...)
+	root := teedCore
+	for _, wrap := range build.rootWrappers {
+		root = wrap(root)
+	}
 
 	return &loggerImpl{
-		zapLogger: zap.New(teedCore, zap.AddCaller(), zap.AddCallerSkip(1)),
-		level:     level,
-		encoder:   encoder,
+		zapLogger: zap.New(root, append(build.zapOptions, zap.AddCallerSkip(1))...),
+		levels:    levels,
 		teedCore:  teedCore,
+		closers:   build.files,
+	}, nil
+}
+
+// newEncoder creates a json or console encoder with the given time format
+func newEncoder(format, timeFormat string) (zapcore.Encoder, error) {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.EncodeTime = timeEncoder(timeFormat)
+
+	switch format {
+	case "json":
+		return zapcore.NewJSONEncoder(encoderConfig), nil
+	case "console":
+		encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+		return zapcore.NewConsoleEncoder(encoderConfig), nil
+	default:
+		return nil, fmt.Errorf("unknown log format: %q", format)
 	}
 }
 
+// timeEncoder returns the encoder of a named time format, treating unknown names as Go time layouts
+func timeEncoder(format string) zapcore.TimeEncoder {
+	switch format {
+	case "iso8601", "":
+		return zapcore.ISO8601TimeEncoder
+	case "rfc3339":
+		return zapcore.RFC3339TimeEncoder
+	case "rfc3339nano":
+		return zapcore.RFC3339NanoTimeEncoder
+	case "epoch":
+		return zapcore.EpochTimeEncoder
+	case "epoch_millis":
+		return zapcore.EpochMillisTimeEncoder
+	default:
+		return zapcore.TimeEncoderOfLayout(format)
+	}
+}
+
+// openOutput returns the writer of an output: stdout, stderr or a file opened for appending,
+// which is rotated if rotation is enabled
+func openOutput(output string, rotation config.LogRotationConfig) (io.Writer, error) {
+	switch {
+	case output == "stdout":
+		return os.Stdout, nil
+	case output == "stderr":
+		return os.Stderr, nil
+	case rotation.Enabled:
+		return NewRotatingFile(output, rotation), nil
+	default:
+		file, err := os.OpenFile(output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log output: %w", err)
+		}
+		return file, nil
+	}
+}
+
+// appendFile appends w to files if it is a file opened by openOutput, rather than stdout or stderr
+func appendFile(files []io.Closer, w io.Writer) []io.Closer {
+	if w == os.Stdout || w == os.Stderr {
+		return files
+	}
+	if c, ok := w.(io.Closer); ok {
+		return append(files, c)
+	}
+	return files
+}
+
+// closeFiles closes every file, returning the errors joined. Files closed already are skipped.
+func closeFiles(files []io.Closer) error {
+	var errs []error
+	for _, c := range files {
+		if err := c.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+			errs = append(errs, fmt.Errorf("failed to close log file: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // Initialize sets up the global logger instance with the specified writers. Thread-safe.
 func Initialize(writers ...io.Writer) {
 	initOnce.Do(func() {
@@ -50,6 +261,20 @@ func Initialize(writers ...io.Writer) {
 	})
 }
 
+// InitializeFromConfig sets up the global logger instance from cfg, see NewFromConfig. Thread-safe.
+// It has no effect if the global logger is already initialized. If cfg is invalid, the global logger
+// falls back to stdout and the error is returned.
+func InitializeFromConfig(cfg config.LogConfig) error {
+	var err error
+	initOnce.Do(func() {
+		globalLogger, err = NewFromConfig(cfg)
+		if err != nil {
+			globalLogger = New(os.Stdout)
+		}
+	})
+	return err
+}
+
 // Global returns the global logger instance, initializing it to stdout if not already set.
 func Global() Logger {
 	if globalLogger == nil {
@@ -108,13 +333,27 @@ func (l *loggerImpl) Panic(msg string, fields ...Field) {
 	l.zapLogger.Panic(msg, convertFields(fields)...)
 }
 
+// logWithCaller logs a message with the caller at pc, e.g. the call to slog handled by NewSlogHandler
+func (l *loggerImpl) logWithCaller(level Level, pc uintptr, msg string, fields []Field) {
+	ce := l.zapLogger.Check(toZapLevel(level), msg)
+	if ce == nil {
+		return
+	}
+	if ce.Caller.Defined && pc != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+		ce.Caller = zapcore.NewEntryCaller(frame.PC, frame.File, frame.Line, true)
+		ce.Caller.Function = frame.Function
+	}
+	ce.Write(convertFields(fields)...)
+}
+
 // With returns a new logger instance with additional structured fields.
 func (l *loggerImpl) With(fields ...Field) Logger {
 	return &loggerImpl{
 		zapLogger: l.zapLogger.With(convertFields(fields)...),
-		level:     l.level,
-		encoder:   l.encoder,
+		levels:    l.levels,
 		teedCore:  l.teedCore,
+		closers:   l.closers,
 	}
 }
 
@@ -123,9 +362,41 @@ func (l *loggerImpl) Sync() error {
 	return l.zapLogger.Sync()
 }
 
-// SetLevel dynamically sets the logging level for this logger instance.
-func (l *loggerImpl) SetLevel(level Level) {
-	l.level.SetLevel(toZapLevel(level))
+// Close closes the files of the sinks. A rotating file written to afterwards is reopened,
+// so the entries logged during the rest of the shutdown are kept; entries written to a closed plain file are lost.
+func (l *loggerImpl) Close() error {
+	return closeFiles(l.closers)
+}
+
+// Levels returns the levels of the sinks by name.
+func (l *loggerImpl) Levels() map[string]Level {
+	levels := make(map[string]Level, len(l.levels))
+	for name, lvl := range l.levels {
+		levels[name] = fromZapLevel(lvl.Level())
+	}
+	return levels
+}
+
+// Enabled reports whether entries of the level are written to at least one sink.
+func (l *loggerImpl) Enabled(level Level) bool {
+	return l.zapLogger.Core().Enabled(toZapLevel(level))
+}
+
+// SetLevel dynamically sets the logging level of the named sinks, or of every sink if no names are given.
+// Unknown sink names are ignored. The change affects the children created by With as well.
+func (l *loggerImpl) SetLevel(level Level, sinks ...string) {
+	if len(sinks) == 0 {
+		for _, lvl := range l.levels {
+			lvl.SetLevel(toZapLevel(level))
+		}
+		return
+	}
+
+	for _, name := range sinks {
+		if lvl, ok := l.levels[name]; ok {
+			lvl.SetLevel(toZapLevel(level))
+		}
+	}
 }
 
 func convertFields(fields []Field) []zap.Field {
@@ -154,3 +425,22 @@ func toZapLevel(level Level) zapcore.Level {
 		return zap.InfoLevel
 	}
 }
+
+func fromZapLevel(level zapcore.Level) Level {
+	switch level {
+	case zap.DebugLevel:
+		return DebugLevel
+	case zap.InfoLevel:
+		return InfoLevel
+	case zap.WarnLevel:
+		return WarnLevel
+	case zap.ErrorLevel:
+		return ErrorLevel
+	case zap.PanicLevel, zap.DPanicLevel:
+		return PanicLevel
+	case zap.FatalLevel:
+		return FatalLevel
+	default:
+		return InfoLevel
+	}
+}
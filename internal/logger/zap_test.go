@@ -0,0 +1,68 @@
+package logger
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AtoyanMikhail/auth/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFromConfig_EndToEnd(t *testing.T) {
+	dir := t.TempDir()
+	appPath := filepath.Join(dir, "app.log")
+	auditPath := filepath.Join(dir, "audit.log")
+
+	l, err := NewFromConfig(config.LogConfig{
+		Level:      "info",
+		Format:     "json",
+		Outputs:    []string{appPath},
+		TimeFormat: "iso8601",
+		Sinks: []config.LogSinkConfig{
+			{Name: "audit", Output: auditPath, Level: "warn", Format: "console"},
+		},
+		Redaction: config.LogRedactionConfig{MaskKeys: []string{"password"}},
+		Sampling: config.LogSamplingConfig{
+			Enabled: true,
+			Tick:    config.Duration(time.Minute),
+			First:   1,
+			Levels:  []string{"warn"},
+		},
+	})
+	require.NoError(t, err)
+
+	l.Info("Login", String("password", "hunter2"), String("user_id", "user-1"))
+	for i := 0; i < 3; i++ {
+		l.Warn("Suspicious login", String("password", "hunter2"))
+	}
+	require.NoError(t, l.Sync())
+
+	app, err := os.ReadFile(appPath)
+	require.NoError(t, err)
+	audit, err := os.ReadFile(auditPath)
+	require.NoError(t, err)
+
+	// Redaction applies to every sink, whatever its format
+	assert.NotContains(t, string(app), "hunter2")
+	assert.NotContains(t, string(audit), "hunter2")
+	assert.Contains(t, string(audit), MaskedValue)
+
+	lines := strings.Split(strings.TrimSpace(string(app)), "\n")
+	require.Len(t, lines, 2, "the info entry and the first sampled warn entry")
+	entry := map[string]any{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, "Login", entry["msg"])
+	assert.Equal(t, MaskedValue, entry["password"])
+	assert.Equal(t, "user-1", entry["user_id"])
+
+	// Sampling wraps the tee, so the audit sink gets the same single warn entry
+	auditLines := strings.Split(strings.TrimSpace(string(audit)), "\n")
+	require.Len(t, auditLines, 1)
+	assert.Contains(t, auditLines[0], "WARN")
+	assert.Contains(t, auditLines[0], "Suspicious login")
+}
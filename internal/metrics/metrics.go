@@ -0,0 +1,230 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AtoyanMikhail/auth/internal/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "auth"
+
+// Reasons of the refresh failures
+const (
+	RefreshFailureNotFound  = "not_found"
+	RefreshFailureInvalid   = "invalid"
+	RefreshFailureUserAgent = "user_agent"
+	RefreshFailureDBError   = "db_error"
+)
+
+// Kinds of the blacklist hits
+const (
+	BlacklistToken = "token"
+	BlacklistUser  = "user"
+)
+
+// Kinds of the tokens deleted by the cleanup and results of its runs
+const (
+	CleanupExpired = "expired"
+	CleanupUsed    = "used"
+
+	CleanupOK      = "ok"
+	CleanupError   = "error"
+	CleanupSkipped = "skipped"
+)
+
+// Registry holds the metrics of the service, separately from the default registry of the prometheus package
+var Registry = prometheus.NewRegistry()
+
+var (
+	// TokensIssued counts the refresh tokens stored
+	TokensIssued = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_issued_total",
+		Help:      "Number of refresh tokens issued.",
+	})
+	// TokensRefreshed counts the refresh tokens exchanged
+	TokensRefreshed = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_refreshed_total",
+		Help:      "Number of refresh tokens exchanged.",
+	})
+	// RefreshFailures counts the failed refreshes by reason
+	RefreshFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "refresh_failures_total",
+		Help:      "Number of failed refreshes by reason.",
+	}, []string{"reason"})
+	// Logouts counts the users logged out of every session
+	Logouts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logouts_total",
+		Help:      "Number of logouts.",
+	})
+	// BlacklistHits counts the blacklisted tokens and users found, by kind
+	BlacklistHits = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "blacklist_hits_total",
+		Help:      "Number of blacklisted tokens and users found.",
+	}, []string{"kind"})
+
+	// CleanupDeleted counts the tokens deleted by the cleanup, by kind
+	CleanupDeleted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cleanup",
+		Name:      "deleted_tokens_total",
+		Help:      "Number of refresh tokens deleted by the cleanup.",
+	}, []string{"kind"})
+	// CleanupRuns counts the cleanup runs by result; runs are skipped while another replica holds the lock
+	CleanupRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cleanup",
+		Name:      "runs_total",
+		Help:      "Number of cleanup runs by result.",
+	}, []string{"result"})
+
+	// DBQueryDuration observes the latency of the Postgres queries by query name
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "postgres",
+		Name:      "query_duration_seconds",
+		Help:      "Latency of the Postgres queries.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"query"})
+	// RedisCommandDuration observes the latency of the Redis commands by command name
+	RedisCommandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "redis",
+		Name:      "command_duration_seconds",
+		Help:      "Latency of the Redis commands.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 14),
+	}, []string{"command"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		TokensIssued,
+		TokensRefreshed,
+		RefreshFailures,
+		Logouts,
+		BlacklistHits,
+		CleanupDeleted,
+		CleanupRuns,
+		DBQueryDuration,
+		RedisCommandDuration,
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "log",
+			Name:      "dropped_entries_total",
+			Help:      "Number of log entries dropped by sampling.",
+		}, func() float64 {
+			return float64(logger.DroppedEntries())
+		}),
+	)
+}
+
+// Handler serves the metrics of Registry
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Since observes the time elapsed since start in seconds
+func Since(observer prometheus.Observer, start time.Time) {
+	observer.Observe(time.Since(start).Seconds())
+}
+
+// RegisterDBStats exposes the connection pool stats of db under the db_name label, e.g. "primary".
+// It has no effect if they are already exposed.
+func RegisterDBStats(db *sql.DB, name string) error {
+	return register(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterActiveSessions exposes the number of active sessions, counted by count when scraped, at most once
+// per scrape interval.
+// It has no effect if the number is already exposed.
+func RegisterActiveSessions(count func(ctx context.Context) (int64, error)) error {
+	return register(newActiveSessionsCollector(count))
+}
+
+// register registers c, ignoring collectors registered already, e.g. by a previous repository instance
+func register(c prometheus.Collector) error {
+	err := Registry.Register(c)
+	var alreadyRegistered prometheus.AlreadyRegisteredError
+	if errors.As(err, &alreadyRegistered) {
+		return nil
+	}
+	return err
+}
+
+var activeSessionsDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "", "active_sessions"),
+	"Number of unexpired and unused refresh tokens.",
+	nil, nil,
+)
+
+const (
+	// activeSessionsTimeout bounds the count of the active sessions
+	activeSessionsTimeout = 2 * time.Second
+	// activeSessionsCacheTTL is about a scrape interval, so that several Prometheus servers scraping the replicas
+	// don't count the whole table on every scrape
+	activeSessionsCacheTTL = 15 * time.Second
+)
+
+// activeSessionsCollector counts the active sessions when scraped, as they also expire without any call.
+// The count is cached for activeSessionsCacheTTL and concurrent scrapes wait for the same count; failed counts
+// are not cached.
+type activeSessionsCollector struct {
+	count func(ctx context.Context) (int64, error)
+	now   func() time.Time
+
+	mu        sync.Mutex
+	value     int64
+	countedAt time.Time
+}
+
+func newActiveSessionsCollector(count func(ctx context.Context) (int64, error)) *activeSessionsCollector {
+	return &activeSessionsCollector{count: count, now: time.Now}
+}
+
+func (c *activeSessionsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeSessionsDesc
+}
+
+func (c *activeSessionsCollector) Collect(ch chan<- prometheus.Metric) {
+	n, err := c.activeSessions()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(activeSessionsDesc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(activeSessionsDesc, prometheus.GaugeValue, float64(n))
+}
+
+// activeSessions returns the cached count, or counts the active sessions if it is older than activeSessionsCacheTTL
+func (c *activeSessionsCollector) activeSessions() (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.countedAt.IsZero() && c.now().Sub(c.countedAt) < activeSessionsCacheTTL {
+		return c.value, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), activeSessionsTimeout)
+	defer cancel()
+
+	n, err := c.count(ctx)
+	if err != nil {
+		return 0, err
+	}
+	c.value, c.countedAt = n, c.now()
+
+	return n, nil
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	TokensIssued.Inc()
+	BlacklistHits.WithLabelValues(BlacklistToken).Inc()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, "auth_tokens_issued_total")
+	assert.Contains(t, body, `auth_blacklist_hits_total{kind="token"}`)
+	assert.Contains(t, body, "auth_log_dropped_entries_total")
+}
+
+func TestActiveSessionsCollector(t *testing.T) {
+	c := newActiveSessionsCollector(func(ctx context.Context) (int64, error) {
+		return 3, nil
+	})
+	assert.Equal(t, 3.0, testutil.ToFloat64(c))
+
+	failing := newActiveSessionsCollector(func(ctx context.Context) (int64, error) {
+		return 0, errors.New("database error")
+	})
+	_, err := testutil.CollectAndLint(failing)
+	assert.Error(t, err)
+}
+
+func TestActiveSessionsCollector_Cache(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	var (
+		calls    int
+		value    int64 = 3
+		countErr error
+		deadline time.Time
+	)
+	c := newActiveSessionsCollector(func(ctx context.Context) (int64, error) {
+		calls++
+		deadline, _ = ctx.Deadline()
+		return value, countErr
+	})
+	c.now = func() time.Time { return now }
+
+	assert.Equal(t, 3.0, testutil.ToFloat64(c))
+	assert.Equal(t, 1, calls)
+	assert.False(t, deadline.IsZero(), "the count is bounded by a timeout")
+
+	// Scrapes within the cache TTL reuse the count
+	value = 5
+	now = now.Add(activeSessionsCacheTTL - time.Second)
+	assert.Equal(t, 3.0, testutil.ToFloat64(c))
+	assert.Equal(t, 1, calls)
+
+	now = now.Add(time.Second)
+	assert.Equal(t, 5.0, testutil.ToFloat64(c))
+	assert.Equal(t, 2, calls)
+
+	// A failed count is not cached
+	now = now.Add(activeSessionsCacheTTL)
+	countErr = errors.New("database error")
+	_, err := testutil.CollectAndLint(c)
+	assert.Error(t, err)
+
+	countErr = nil
+	value = 7
+	assert.Equal(t, 7.0, testutil.ToFloat64(c))
+	assert.Equal(t, 4, calls)
+}
+
+func TestRegister_AlreadyRegistered(t *testing.T) {
+	count := func(ctx context.Context) (int64, error) { return 0, nil }
+
+	require.NoError(t, RegisterActiveSessions(count))
+	assert.NoError(t, RegisterActiveSessions(count))
+}
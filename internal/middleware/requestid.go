@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/AtoyanMikhail/auth/internal/logger"
+	"github.com/AtoyanMikhail/auth/internal/tracing"
+)
+
+const (
+	// RequestIDHeader carries the request ID in both requests and responses
+	RequestIDHeader = "X-Request-ID"
+	// TraceParentHeader is the W3C Trace Context header, see https://www.w3.org/TR/trace-context/
+	TraceParentHeader = "traceparent"
+
+	maxRequestIDLength = 128
+)
+
+type requestIDKey struct{}
+
+// RequestID assigns an ID to every request: the incoming X-Request-ID header if it is valid, or a random one.
+// The ID is returned in the X-Request-ID response header and stored in the request context along with
+// a child of l with the request_id field, and the trace_id field of the current span, or of the traceparent header
+// if the request is not traced.
+// Handlers, services and repositories get that logger with logger.FromContext.
+func RequestID(l logger.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			w.Header().Set(RequestIDHeader, id)
+
+			fields := []logger.Field{logger.String("request_id", id)}
+			traceID := tracing.TraceID(r.Context())
+			if traceID == "" {
+				traceID = traceIDFromHeader(r.Header.Get(TraceParentHeader))
+			}
+			if traceID != "" {
+				fields = append(fields, logger.String("trace_id", traceID))
+			}
+
+			ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+			ctx = logger.WithContext(ctx, l.With(fields...))
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequestIDFromContext returns the request ID set by the RequestID middleware, or an empty string
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// newRequestID generates a random 128-bit hex encoded ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts non-empty IDs of printable ASCII characters, so that clients can't inject
+// arbitrary data into logs and response headers
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// traceIDFromHeader extracts the trace ID from a traceparent header: version-traceid-parentid-flags
+func traceIDFromHeader(header string) string {
+	parts := strings.Split(header, "-")
+	if len(parts) < 4 || len(parts[1]) != 32 || parts[1] == strings.Repeat("0", 32) {
+		return ""
+	}
+	if _, err := hex.DecodeString(parts[1]); err != nil {
+		return ""
+	}
+	return strings.ToLower(parts[1])
+}
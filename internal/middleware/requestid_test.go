@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AtoyanMikhail/auth/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Mock logger recording the fields it was created with
+type mockLogger struct {
+	fields []logger.Field
+}
+
+func (m *mockLogger) Debug(msg string, fields ...logger.Field) {}
+func (m *mockLogger) Info(msg string, fields ...logger.Field)  {}
+func (m *mockLogger) Warn(msg string, fields ...logger.Field)  {}
+func (m *mockLogger) Error(msg string, fields ...logger.Field) {}
+func (m *mockLogger) Fatal(msg string, fields ...logger.Field) {}
+func (m *mockLogger) Panic(msg string, fields ...logger.Field) {}
+func (m *mockLogger) With(fields ...logger.Field) logger.Logger {
+	return &mockLogger{fields: append(append([]logger.Field{}, m.fields...), fields...)}
+}
+func (m *mockLogger) Sync() error                                  { return nil }
+func (m *mockLogger) SetLevel(level logger.Level, sinks ...string) {}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name        string
+		headers     map[string]string
+		wantID      string
+		wantTraceID string
+	}{
+		{
+			name:   "generated id",
+			wantID: "",
+		},
+		{
+			name:    "incoming id",
+			headers: map[string]string{RequestIDHeader: "req-123"},
+			wantID:  "req-123",
+		},
+		{
+			name:    "invalid incoming id is replaced",
+			headers: map[string]string{RequestIDHeader: "bad id\n"},
+			wantID:  "",
+		},
+		{
+			name: "trace id from traceparent",
+			headers: map[string]string{
+				RequestIDHeader:   "req-456",
+				TraceParentHeader: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			},
+			wantID:      "req-456",
+			wantTraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotID string
+			var gotLogger logger.Logger
+			handler := RequestID(&mockLogger{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotID = RequestIDFromContext(r.Context())
+				gotLogger = logger.FromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/tokens/refresh", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if tt.wantID != "" {
+				assert.Equal(t, tt.wantID, gotID)
+			} else {
+				assert.Len(t, gotID, 32)
+			}
+			assert.Equal(t, gotID, rec.Header().Get(RequestIDHeader))
+
+			wantFields := []logger.Field{logger.String("request_id", gotID)}
+			if tt.wantTraceID != "" {
+				wantFields = append(wantFields, logger.String("trace_id", tt.wantTraceID))
+			}
+			assert.Equal(t, wantFields, gotLogger.(*mockLogger).fields)
+		})
+	}
+}
+
+func TestRequestID_SpanTraceID(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("0af7651916cd43dd8448eb211c80319c")
+	spanID, _ := trace.SpanIDFromHex("b7ad6b7169203331")
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID})
+
+	var gotLogger logger.Logger
+	handler := RequestID(&mockLogger{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotLogger = logger.FromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/tokens/refresh", nil)
+	req.Header.Set(RequestIDHeader, "req-789")
+	req.Header.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req = req.WithContext(trace.ContextWithSpanContext(req.Context(), sc))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, []logger.Field{
+		logger.String("request_id", "req-789"),
+		logger.String("trace_id", "0af7651916cd43dd8448eb211c80319c"),
+	}, gotLogger.(*mockLogger).fields)
+}
+
+func TestRequestID_LoggerOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+	}{
+		{name: "generated id"},
+		{name: "propagated id", incoming: "req-123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l, err := logger.NewWithSinks(logger.Sink{Name: "test", Writer: &buf, Level: logger.InfoLevel})
+			require.NoError(t, err)
+
+			handler := RequestID(l)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				logger.FromContext(r.Context()).Info("Refresh requested")
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/tokens/refresh", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			id := rec.Header().Get(RequestIDHeader)
+			if tt.incoming != "" {
+				assert.Equal(t, tt.incoming, id)
+			} else {
+				assert.Len(t, id, 32)
+			}
+
+			entry := map[string]any{}
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+			assert.Equal(t, "Refresh requested", entry["msg"])
+			assert.Equal(t, id, entry["request_id"])
+		})
+	}
+}
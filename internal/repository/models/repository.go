@@ -2,17 +2,33 @@ package models
 
 import (
 	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrTokenNotFound is returned by GetByLookupHash if no token has the lookup hash
+	ErrTokenNotFound = errors.New("refresh token not found")
+	// ErrTokenUsed is returned by MarkAsUsed if the token is used already, e.g. by a concurrent refresh, or deleted
+	ErrTokenUsed = errors.New("refresh token used already or not found")
 )
 
 type RefreshTokenRepository interface {
 	Create(ctx context.Context, token *RefreshToken) error
 	Close() error
 	RunMigrations(migrationsFilePath string) error
+	Ping(ctx context.Context) error
+	CheckMigrations(ctx context.Context, migrationsPath string) error
 	GetActiveByUserID(ctx context.Context, userID string) (*RefreshToken, error)
 	GetByID(ctx context.Context, id int) (*RefreshToken, error)
+	GetByLookupHash(ctx context.Context, lookupHash string) (*RefreshToken, error)
 	MarkAsUsed(ctx context.Context, tokenID int) error
 	DeleteAllByUserID(ctx context.Context, userID string) error
 	Delete(ctx context.Context, tokenID int) error
 	CleanExpired(ctx context.Context) (int64, error)
+	DeleteExpiredBatch(ctx context.Context, limit int) (int64, error)
+	DeleteUsedBatch(ctx context.Context, usedBefore time.Time, limit int) (int64, error)
+	TryLock(ctx context.Context, key int64) (unlock func() error, acquired bool, err error)
 	GetAllActiveByUserID(ctx context.Context, userID string) ([]*RefreshToken, error)
+	CountActive(ctx context.Context) (int64, error)
 }
@@ -12,5 +12,8 @@ type RefreshToken struct {
 	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
 	IsUsed    bool      `db:"is_used" json:"is_used"`
 	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+
+	// LookupHash finds the token by its value, see tokenhash.Hasher.Lookup
+	LookupHash string `db:"lookup_hash" json:"-"`
 }
 
@@ -3,47 +3,206 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/AtoyanMikhail/auth/internal/config"
 	"github.com/AtoyanMikhail/auth/internal/logger"
+	"github.com/AtoyanMikhail/auth/internal/metrics"
 	"github.com/AtoyanMikhail/auth/internal/repository/models"
+	"github.com/AtoyanMikhail/auth/internal/tracing"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file" //used for migrations
+	"github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq" //postgres driver
+	"go.opentelemetry.io/otel/trace"
 )
 
 type refreshTokenRepo struct {
-	db  *sqlx.DB
-	l   logger.Logger
-	cfg config.DatabaseConfig
-}
-
-func NewRefreshTokenRepository(cfg config.DatabaseConfig, l logger.Logger) (models.RefreshTokenRepository, error) {
-	dsn := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		cfg.Host,
-		cfg.Port,
-		cfg.User,
-		cfg.Password,
-		cfg.DBName,
-		cfg.SSLMode,
-	)
+	db *sqlx.DB
+	// stmts are the prepared statements of db
+	stmts *stmtCache
+	// replicas receive the read-only queries, see reader
+	replicas []*stmtCache
+	next     atomic.Uint64
+	l        logger.Logger
+	cfg      config.DatabaseConfig
+}
+
+const (
+	// pingTimeout limits every connection attempt
+	pingTimeout = 5 * time.Second
+	// maxConnectBackoff caps the delay between connection attempts
+	maxConnectBackoff = 30 * time.Second
+)
+
+// NewRefreshTokenRepository connects to the primary and the replicas of cfg. The connection is retried
+// until it succeeds, the retries are exhausted or ctx is done.
+func NewRefreshTokenRepository(ctx context.Context, cfg config.DatabaseConfig, l logger.Logger) (models.RefreshTokenRepository, error) {
+	db, err := openDB(ctx, cfg, l)
+	if err != nil {
+		return nil, err
+	}
+
+	repo := &refreshTokenRepo{db: db, stmts: newStmtCache(db), l: l, cfg: cfg}
+
+	for i, replicaDSN := range cfg.ReplicaDSNs {
+		replicaCfg := cfg
+		replicaCfg.DSN = replicaDSN
+		replica, err := openDB(ctx, replicaCfg, l)
+		if err != nil {
+			repo.Close()
+			return nil, fmt.Errorf("replica %d: %w", i, err)
+		}
+		repo.replicas = append(repo.replicas, newStmtCache(replica))
+	}
+
+	if err := metrics.RegisterDBStats(db.DB, "primary"); err != nil {
+		l.Warn("Failed to register db stats metrics", logger.Error(err))
+	}
+	for i, replica := range repo.replicas {
+		if err := metrics.RegisterDBStats(replica.db.DB, fmt.Sprintf("replica%d", i)); err != nil {
+			l.Warn("Failed to register db stats metrics", logger.Error(err))
+		}
+	}
+	if err := metrics.RegisterActiveSessions(repo.CountActive); err != nil {
+		l.Warn("Failed to register active sessions metric", logger.Error(err))
+	}
+
+	return repo, nil
+}
+
+// openDB opens the connection pool of cfg and checks the connection
+func openDB(ctx context.Context, cfg config.DatabaseConfig, l logger.Logger) (*sqlx.DB, error) {
+	dsn, err := dsnFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
 	db, err := sqlx.Open("postgres", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("could not open db connection: %v", err)
 	}
-	if err = db.Ping(); err != nil {
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime))
+	db.SetConnMaxIdleTime(time.Duration(cfg.ConnMaxIdleTime))
+
+	if err = ping(ctx, db, cfg, l); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("could not establish db connection: %v", err)
 	}
 
-	return &refreshTokenRepo{db: db, l: l, cfg: cfg}, nil
+	return db, nil
+}
+
+// dsnFromConfig returns cfg.DSN, or the DSN built from the connection settings, with the statement timeout
+// as a run-time parameter
+func dsnFromConfig(cfg config.DatabaseConfig) (string, error) {
+	dsn := cfg.DSN
+	if dsn == "" {
+		dsn = fmt.Sprintf(
+			"host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+			cfg.Host,
+			cfg.Port,
+			cfg.User,
+			cfg.Password,
+			cfg.DBName,
+			cfg.SSLMode,
+		)
+	}
+
+	if cfg.StatementTimeout <= 0 {
+		return dsn, nil
+	}
+	timeout := strconv.FormatInt(time.Duration(cfg.StatementTimeout).Milliseconds(), 10)
+
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return dsn + " statement_timeout=" + timeout, nil
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		// The error may contain the password
+		return "", errors.New("invalid database dsn")
+	}
+	query := u.Query()
+	query.Set("statement_timeout", timeout)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// ping checks the connection, retrying with an exponential backoff, so that the service survives a database
+// starting at the same time, e.g. under docker-compose. It gives up as soon as ctx is done, e.g. on SIGTERM.
+func ping(ctx context.Context, db *sqlx.DB, cfg config.DatabaseConfig, l logger.Logger) error {
+	backoff := time.Duration(cfg.ConnectBackoff)
+	for attempt := 0; ; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, pingTimeout)
+		err := db.PingContext(pingCtx)
+		cancel()
+		if err == nil || attempt >= cfg.ConnectRetries {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		l.Warn("Failed to connect to Postgres, retrying",
+			logger.Error(err),
+			logger.Int("attempt", attempt+1),
+			logger.String("backoff", backoff.String()))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxConnectBackoff)
+	}
+}
+
+// queryRun is a running query: its span and latency measurement
+type queryRun struct {
+	name  string
+	start time.Time
+	span  trace.Span
+}
+
+// startQuery starts the span and the latency measurement of the named query, ended by queryRun.end
+func startQuery(ctx context.Context, name, query string) (context.Context, *queryRun) {
+	ctx, span := tracing.StartQuery(ctx, name, query)
+	return ctx, &queryRun{name: name, start: time.Now(), span: span}
+}
+
+// fail records err on the span of the query
+func (q *queryRun) fail(err error) {
+	tracing.RecordError(q.span, err)
+}
+
+func (q *queryRun) end() {
+	metrics.Since(metrics.DBQueryDuration.WithLabelValues(q.name), q.start)
+	q.span.End()
+}
+
+// log returns the request scoped logger of ctx, falling back to the repository logger
+func (r *refreshTokenRepo) log(ctx context.Context) logger.Logger {
+	return logger.FromContextOr(ctx, r.l)
 }
 
 func (r *refreshTokenRepo) Close() error {
-	return r.db.Close()
+	errs := []error{r.stmts.close()}
+	for _, replica := range r.replicas {
+		errs = append(errs, replica.close())
+	}
+	return errors.Join(errs...)
 }
 
 func (r *refreshTokenRepo) RunMigrations(migrationsPath string) error {
@@ -67,26 +226,95 @@ func (r *refreshTokenRepo) RunMigrations(migrationsPath string) error {
 	return nil
 }
 
+// Ping checks the connection to the database
+func (r *refreshTokenRepo) Ping(ctx context.Context) error {
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to ping db: %w", err)
+	}
+	return nil
+}
+
+// CheckMigrations returns an error if the schema is dirty or behind the latest migration in migrationsPath
+func (r *refreshTokenRepo) CheckMigrations(ctx context.Context, migrationsPath string) error {
+	latest, err := latestMigration(migrationsPath)
+	if err != nil {
+		return err
+	}
+
+	var version uint
+	var dirty bool
+	err = r.db.QueryRowxContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to get migration version: %w", err)
+	}
+
+	if dirty {
+		return fmt.Errorf("migration %d is dirty", version)
+	}
+	if version < latest {
+		return fmt.Errorf("migrations are pending: schema version is %d, latest is %d", version, latest)
+	}
+
+	return nil
+}
+
+// latestMigration returns the version of the last migration in migrationsPath, or 0 if there are none
+func latestMigration(migrationsPath string) (uint, error) {
+	src, err := (&file.File{}).Open("file://" + migrationsPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open migrations: %w", err)
+	}
+	defer src.Close()
+
+	version, err := src.First()
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	for {
+		next, err := src.Next(version)
+		if errors.Is(err, os.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read migrations: %w", err)
+		}
+		version = next
+	}
+}
+
+// Create stores token, which must have both its hashes, see tokenhash.Hasher
 func (r *refreshTokenRepo) Create(ctx context.Context, token *models.RefreshToken) error {
+	if token.LookupHash == "" {
+		return errors.New("refresh token has no lookup hash")
+	}
+
 	query := `
-		INSERT INTO refresh_tokens (user_id, token_hash, user_agent, ip_address, expires_at)
-		VALUES (:user_id, :token_hash, :user_agent, :ip_address, :expires_at)
+		INSERT INTO refresh_tokens (user_id, token_hash, user_agent, ip_address, expires_at, lookup_hash)
+		VALUES (:user_id, :token_hash, :user_agent, :ip_address, :expires_at, :lookup_hash)
 		RETURNING id, created_at, updated_at`
 
-	stmt, err := r.db.PrepareNamedContext(ctx, query)
+	ctx, q := startQuery(ctx, "create", query)
+	defer q.end()
+
+	stmt, err := r.stmts.prepareNamed(ctx, query)
 	if err != nil {
-		r.l.Error("Failed to prepare query", logger.Error(err))
+		q.fail(err)
+		r.log(ctx).Error("Failed to prepare query", logger.Error(err))
 		return fmt.Errorf("failed to prepare query: %w", err)
 	}
-	defer stmt.Close()
 
 	err = stmt.QueryRowxContext(ctx, token).Scan(&token.ID, &token.CreatedAt, &token.UpdatedAt)
 	if err != nil {
-		r.l.Error("Failed to execute insert query", logger.Error(err))
+		q.fail(err)
+		r.log(ctx).Error("Failed to execute insert query", logger.Error(err))
 		return err
 	}
 
-	r.l.Info("Refresh token created", logger.Int("id", token.ID), logger.String("user_id", token.UserID))
+	r.log(ctx).Info("Refresh token created", logger.Int("id", token.ID), logger.String("user_id", token.UserID))
 	return nil
 }
 
@@ -98,12 +326,16 @@ func (r *refreshTokenRepo) GetActiveByUserID(ctx context.Context, userID string)
 		ORDER BY created_at DESC
 		LIMIT 1`
 
+	ctx, q := startQuery(ctx, "get_active_by_user_id", query)
+	defer q.end()
+
 	token := &models.RefreshToken{}
-	err := r.db.GetContext(ctx, token, query, userID)
+	err := r.reader(ctx).get(ctx, token, query, userID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("no active refresh token found for user %s", userID)
 		}
+		q.fail(err)
 		return nil, fmt.Errorf("failed to get refresh token: %w", err)
 	}
 
@@ -116,50 +348,89 @@ func (r *refreshTokenRepo) GetByID(ctx context.Context, id int) (*models.Refresh
 		FROM refresh_tokens
 		WHERE id = $1`
 
+	ctx, q := startQuery(ctx, "get_by_id", query)
+	defer q.end()
+
 	token := &models.RefreshToken{}
-	err := r.db.GetContext(ctx, token, query, id)
+	err := r.reader(ctx).get(ctx, token, query, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("refresh token with id %d not found", id)
 		}
+		q.fail(err)
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	return token, nil
+}
+
+// GetByLookupHash returns the token with the lookup hash, see tokenhash.Hasher.Lookup. It reads from the primary,
+// as the token is checked right before it is marked as used.
+func (r *refreshTokenRepo) GetByLookupHash(ctx context.Context, lookupHash string) (*models.RefreshToken, error) {
+	query := `
+		SELECT id, user_id, token_hash, user_agent, ip_address, created_at, expires_at, is_used, updated_at, lookup_hash
+		FROM refresh_tokens
+		WHERE lookup_hash = $1`
+
+	ctx, q := startQuery(ctx, "get_by_lookup_hash", query)
+	defer q.end()
+
+	token := &models.RefreshToken{}
+	err := r.stmts.get(ctx, token, query, lookupHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, models.ErrTokenNotFound
+		}
+		q.fail(err)
 		return nil, fmt.Errorf("failed to get refresh token: %w", err)
 	}
 
 	return token, nil
 }
 
+// MarkAsUsed marks the token as used, unless it is used already: of concurrent calls for the same token,
+// only one succeeds and the others return models.ErrTokenUsed
 func (r *refreshTokenRepo) MarkAsUsed(ctx context.Context, tokenID int) error {
 	query := `
 		UPDATE refresh_tokens 
 		SET is_used = true, updated_at = NOW() 
-		WHERE id = $1`
+		WHERE id = $1 AND is_used = false`
 
-	result, err := r.db.ExecContext(ctx, query, tokenID)
+	ctx, q := startQuery(ctx, "mark_as_used", query)
+	defer q.end()
+
+	result, err := r.stmts.exec(ctx, query, tokenID)
 	if err != nil {
-		r.l.Error("Failed to mark token as used", logger.Error(err), logger.Int("token_id", tokenID))
+		q.fail(err)
+		r.log(ctx).Error("Failed to mark token as used", logger.Error(err), logger.Int("token_id", tokenID))
 		return fmt.Errorf("failed to mark token as used: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		r.l.Error("Failed to get rows affected after mark as used", logger.Error(err))
+		q.fail(err)
+		r.log(ctx).Error("Failed to get rows affected after mark as used", logger.Error(err))
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
 	if rowsAffected == 0 {
-		r.l.Warn("Token not found for mark as used", logger.Int("token_id", tokenID))
-		return fmt.Errorf("token with id %d not found", tokenID)
+		r.log(ctx).Warn("Token not found or used already for mark as used", logger.Int("token_id", tokenID))
+		return fmt.Errorf("token with id %d: %w", tokenID, models.ErrTokenUsed)
 	}
 
-	r.l.Info("Refresh token marked as used", logger.Int("token_id", tokenID))
+	r.log(ctx).Info("Refresh token marked as used", logger.Int("token_id", tokenID))
 	return nil
 }
 
 func (r *refreshTokenRepo) DeleteAllByUserID(ctx context.Context, userID string) error {
 	query := `DELETE FROM refresh_tokens WHERE user_id = $1`
 
-	_, err := r.db.ExecContext(ctx, query, userID)
+	ctx, q := startQuery(ctx, "delete_all_by_user_id", query)
+	defer q.end()
+
+	_, err := r.stmts.exec(ctx, query, userID)
 	if err != nil {
+		q.fail(err)
 		return fmt.Errorf("failed to delete tokens for user %s: %w", userID, err)
 	}
 
@@ -169,37 +440,47 @@ func (r *refreshTokenRepo) DeleteAllByUserID(ctx context.Context, userID string)
 func (r *refreshTokenRepo) Delete(ctx context.Context, tokenID int) error {
 	query := `DELETE FROM refresh_tokens WHERE id = $1`
 
-	result, err := r.db.ExecContext(ctx, query, tokenID)
+	ctx, q := startQuery(ctx, "delete", query)
+	defer q.end()
+
+	result, err := r.stmts.exec(ctx, query, tokenID)
 	if err != nil {
-		r.l.Error("Failed to delete token", logger.Error(err), logger.Int("token_id", tokenID))
+		q.fail(err)
+		r.log(ctx).Error("Failed to delete token", logger.Error(err), logger.Int("token_id", tokenID))
 		return fmt.Errorf("failed to delete token: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		r.l.Error("Failed to get rows affected after delete", logger.Error(err))
+		q.fail(err)
+		r.log(ctx).Error("Failed to get rows affected after delete", logger.Error(err))
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
 	if rowsAffected == 0 {
-		r.l.Warn("Token not found for delete", logger.Int("token_id", tokenID))
+		r.log(ctx).Warn("Token not found for delete", logger.Int("token_id", tokenID))
 		return fmt.Errorf("token with id %d not found", tokenID)
 	}
 
-	r.l.Info("Refresh token deleted", logger.Int("token_id", tokenID))
+	r.log(ctx).Info("Refresh token deleted", logger.Int("token_id", tokenID))
 	return nil
 }
 
 func (r *refreshTokenRepo) CleanExpired(ctx context.Context) (int64, error) {
 	query := `DELETE FROM refresh_tokens WHERE expires_at < NOW()`
 
-	result, err := r.db.ExecContext(ctx, query)
+	ctx, q := startQuery(ctx, "clean_expired", query)
+	defer q.end()
+
+	result, err := r.stmts.exec(ctx, query)
 	if err != nil {
+		q.fail(err)
 		return 0, fmt.Errorf("failed to clean expired tokens: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
+		q.fail(err)
 		return 0, fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
@@ -213,11 +494,114 @@ func (r *refreshTokenRepo) GetAllActiveByUserID(ctx context.Context, userID stri
 		WHERE user_id = $1 AND expires_at > NOW() AND is_used = false
 		ORDER BY created_at DESC`
 
+	ctx, q := startQuery(ctx, "get_all_active_by_user_id", query)
+	defer q.end()
+
 	var tokens []*models.RefreshToken
-	err := r.db.SelectContext(ctx, &tokens, query, userID)
+	err := r.reader(ctx).selectAll(ctx, &tokens, query, userID)
 	if err != nil {
+		q.fail(err)
 		return nil, fmt.Errorf("failed to get active tokens for user %s: %w", userID, err)
 	}
 
 	return tokens, nil
 }
+
+// DeleteExpiredBatch deletes up to limit expired tokens and returns the number deleted
+func (r *refreshTokenRepo) DeleteExpiredBatch(ctx context.Context, limit int) (int64, error) {
+	query := `
+		DELETE FROM refresh_tokens
+		WHERE id IN (SELECT id FROM refresh_tokens WHERE expires_at < NOW() LIMIT $1)`
+
+	ctx, q := startQuery(ctx, "delete_expired_batch", query)
+	defer q.end()
+
+	result, err := r.stmts.exec(ctx, query, limit)
+	if err != nil {
+		q.fail(err)
+		return 0, fmt.Errorf("failed to delete expired tokens: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		q.fail(err)
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// DeleteUsedBatch deletes up to limit tokens used before the given time and returns the number deleted
+func (r *refreshTokenRepo) DeleteUsedBatch(ctx context.Context, usedBefore time.Time, limit int) (int64, error) {
+	query := `
+		DELETE FROM refresh_tokens
+		WHERE id IN (SELECT id FROM refresh_tokens WHERE is_used = true AND updated_at < $1 LIMIT $2)`
+
+	ctx, q := startQuery(ctx, "delete_used_batch", query)
+	defer q.end()
+
+	result, err := r.stmts.exec(ctx, query, usedBefore, limit)
+	if err != nil {
+		q.fail(err)
+		return 0, fmt.Errorf("failed to delete used tokens: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		q.fail(err)
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// TryLock takes the session level advisory lock of key without waiting. The lock is held by a dedicated
+// connection until unlock is called, so that it is not released by the pool returning the connection.
+// If another session holds the lock, acquired is false.
+func (r *refreshTokenRepo) TryLock(ctx context.Context, key int64) (unlock func() error, acquired bool, err error) {
+	conn, err := r.db.Connx(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get db connection: %w", err)
+	}
+
+	if err := conn.QueryRowxContext(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, false, fmt.Errorf("failed to take advisory lock: %w", err)
+	}
+	if !acquired {
+		conn.Close()
+		return nil, false, nil
+	}
+
+	unlock = func() error {
+		defer conn.Close()
+		// The lock must be released even if the context of the caller is done
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, key); err != nil {
+			// The lock is held by the session until it ends: the connection is discarded rather than returned
+			// to the pool, where it would keep the lock and make every later cleanup skip
+			_ = conn.Raw(func(any) error { return driver.ErrBadConn })
+			return fmt.Errorf("failed to release advisory lock: %w", err)
+		}
+		return nil
+	}
+
+	return unlock, true, nil
+}
+
+// CountActive returns the number of unexpired and unused tokens
+func (r *refreshTokenRepo) CountActive(ctx context.Context) (int64, error) {
+	query := `SELECT COUNT(*) FROM refresh_tokens WHERE expires_at > NOW() AND is_used = false`
+
+	ctx, q := startQuery(ctx, "count_active", query)
+	defer q.end()
+
+	var count int64
+	if err := r.reader(ctx).get(ctx, &count, query); err != nil {
+		q.fail(err)
+		return 0, fmt.Errorf("failed to count active tokens: %w", err)
+	}
+
+	return count, nil
+}
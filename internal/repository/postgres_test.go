@@ -4,7 +4,11 @@ import (
 	"context"
 	"database/sql"
 	_ "database/sql/driver"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -15,6 +19,12 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Mock logger
@@ -28,7 +38,7 @@ func (m *mockLogger) Fatal(msg string, fields ...logger.Field) {}
 func (m *mockLogger) Panic(msg string, fields ...logger.Field) {}
 func (m *mockLogger) With(fields ...logger.Field) logger.Logger { return m }
 func (m *mockLogger) Sync() error                               { return nil }
-func (m *mockLogger) SetLevel(level logger.Level)               {}
+func (m *mockLogger) SetLevel(level logger.Level, sinks ...string) {}
 
 // Test repo initialization helper
 func SetupTestRepo(t *testing.T) (*refreshTokenRepo, sqlmock.Sqlmock, func()) {
@@ -38,9 +48,10 @@ func SetupTestRepo(t *testing.T) (*refreshTokenRepo, sqlmock.Sqlmock, func()) {
 	sqlxDB := sqlx.NewDb(db, "postgres")
 	
 	repo := &refreshTokenRepo{
-		db:  sqlxDB,
-		l:   &mockLogger{},
-		cfg: config.DatabaseConfig{},
+		db:    sqlxDB,
+		stmts: newStmtCache(sqlxDB),
+		l:     &mockLogger{},
+		cfg:   config.DatabaseConfig{},
 	}
 
 	cleanup := func() {
@@ -53,19 +64,17 @@ func SetupTestRepo(t *testing.T) (*refreshTokenRepo, sqlmock.Sqlmock, func()) {
 // Test token initialization helper
 func createTestToken() *models.RefreshToken {
 	return &models.RefreshToken{
-		UserID:    "test-user-id",
-		TokenHash: "test-hash",
-		UserAgent: "test-agent",
-		IPAddress: "192.168.1.1",
-		ExpiresAt: time.Now().Add(24 * time.Hour),
-		IsUsed:    false,
+		UserID:     "test-user-id",
+		TokenHash:  "test-hash",
+		LookupHash: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		UserAgent:  "test-agent",
+		IPAddress:  "192.168.1.1",
+		ExpiresAt:  time.Now().Add(24 * time.Hour),
+		IsUsed:     false,
 	}
 }
 
 func TestRefreshTokenRepo_Create(t *testing.T) {
-	repo, mock, cleanup := SetupTestRepo(t)
-	defer cleanup()
-
 	tests := []struct {
 		name    string
 		token   *models.RefreshToken
@@ -79,12 +88,23 @@ func TestRefreshTokenRepo_Create(t *testing.T) {
 			mockFn: func(m sqlmock.Sqlmock, token *models.RefreshToken) {
 				m.ExpectPrepare(`INSERT INTO refresh_tokens`).
 					ExpectQuery().
-					WithArgs(token.UserID, token.TokenHash, token.UserAgent, token.IPAddress, token.ExpiresAt).
+					WithArgs(token.UserID, token.TokenHash, token.UserAgent, token.IPAddress, token.ExpiresAt, token.LookupHash).
 					WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "updated_at"}).
 						AddRow(1, time.Now(), time.Now()))
 			},
 			wantErr: false,
 		},
+		{
+			name: "missing lookup hash",
+			token: func() *models.RefreshToken {
+				token := createTestToken()
+				token.LookupHash = ""
+				return token
+			}(),
+			mockFn:  func(m sqlmock.Sqlmock, token *models.RefreshToken) {},
+			wantErr: true,
+			errMsg:  "refresh token has no lookup hash",
+		},
 		{
 			name:  "prepare statement error",
 			token: createTestToken(),
@@ -101,7 +121,7 @@ func TestRefreshTokenRepo_Create(t *testing.T) {
 			mockFn: func(m sqlmock.Sqlmock, token *models.RefreshToken) {
 				m.ExpectPrepare(`INSERT INTO refresh_tokens`).
 					ExpectQuery().
-					WithArgs(token.UserID, token.TokenHash, token.UserAgent, token.IPAddress, token.ExpiresAt).
+					WithArgs(token.UserID, token.TokenHash, token.UserAgent, token.IPAddress, token.ExpiresAt, token.LookupHash).
 					WillReturnError(fmt.Errorf("query error"))
 			},
 			wantErr: true,
@@ -111,6 +131,9 @@ func TestRefreshTokenRepo_Create(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			repo, mock, cleanup := SetupTestRepo(t)
+			defer cleanup()
+
 			tt.mockFn(mock, tt.token)
 
 			err := repo.Create(context.Background(), tt.token)
@@ -133,9 +156,6 @@ func TestRefreshTokenRepo_Create(t *testing.T) {
 }
 
 func TestRefreshTokenRepo_GetActiveByUserID(t *testing.T) {
-	repo, mock, cleanup := SetupTestRepo(t)
-	defer cleanup()
-
 	userID := "test-user-id"
 	expectedToken := createTestToken()
 	expectedToken.ID = 1
@@ -162,7 +182,7 @@ func TestRefreshTokenRepo_GetActiveByUserID(t *testing.T) {
 					expectedToken.UserAgent, expectedToken.IPAddress, expectedToken.CreatedAt,
 					expectedToken.ExpiresAt, expectedToken.IsUsed, expectedToken.UpdatedAt,
 				)
-				m.ExpectQuery(`SELECT .+ FROM refresh_tokens WHERE user_id = \$1`).
+				m.ExpectPrepare(`SELECT .+ FROM refresh_tokens WHERE user_id = \$1`).ExpectQuery().
 					WithArgs(userID).
 					WillReturnRows(rows)
 			},
@@ -173,7 +193,7 @@ func TestRefreshTokenRepo_GetActiveByUserID(t *testing.T) {
 			name:   "no rows found",
 			userID: userID,
 			mockFn: func(m sqlmock.Sqlmock) {
-				m.ExpectQuery(`SELECT .+ FROM refresh_tokens WHERE user_id = \$1`).
+				m.ExpectPrepare(`SELECT .+ FROM refresh_tokens WHERE user_id = \$1`).ExpectQuery().
 					WithArgs(userID).
 					WillReturnError(sql.ErrNoRows)
 			},
@@ -185,7 +205,7 @@ func TestRefreshTokenRepo_GetActiveByUserID(t *testing.T) {
 			name:   "database error",
 			userID: userID,
 			mockFn: func(m sqlmock.Sqlmock) {
-				m.ExpectQuery(`SELECT .+ FROM refresh_tokens WHERE user_id = \$1`).
+				m.ExpectPrepare(`SELECT .+ FROM refresh_tokens WHERE user_id = \$1`).ExpectQuery().
 					WithArgs(userID).
 					WillReturnError(fmt.Errorf("database error"))
 			},
@@ -197,6 +217,9 @@ func TestRefreshTokenRepo_GetActiveByUserID(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			repo, mock, cleanup := SetupTestRepo(t)
+			defer cleanup()
+
 			tt.mockFn(mock)
 
 			result, err := repo.GetActiveByUserID(context.Background(), tt.userID)
@@ -220,9 +243,6 @@ func TestRefreshTokenRepo_GetActiveByUserID(t *testing.T) {
 }
 
 func TestRefreshTokenRepo_GetByID(t *testing.T) {
-	repo, mock, cleanup := SetupTestRepo(t)
-	defer cleanup()
-
 	tokenID := 1
 	expectedToken := createTestToken()
 	expectedToken.ID = tokenID
@@ -249,7 +269,7 @@ func TestRefreshTokenRepo_GetByID(t *testing.T) {
 					expectedToken.UserAgent, expectedToken.IPAddress, expectedToken.CreatedAt,
 					expectedToken.ExpiresAt, expectedToken.IsUsed, expectedToken.UpdatedAt,
 				)
-				m.ExpectQuery(`SELECT .+ FROM refresh_tokens WHERE id = \$1`).
+				m.ExpectPrepare(`SELECT .+ FROM refresh_tokens WHERE id = \$1`).ExpectQuery().
 					WithArgs(tokenID).
 					WillReturnRows(rows)
 			},
@@ -260,7 +280,7 @@ func TestRefreshTokenRepo_GetByID(t *testing.T) {
 			name:    "token not found",
 			tokenID: tokenID,
 			mockFn: func(m sqlmock.Sqlmock) {
-				m.ExpectQuery(`SELECT .+ FROM refresh_tokens WHERE id = \$1`).
+				m.ExpectPrepare(`SELECT .+ FROM refresh_tokens WHERE id = \$1`).ExpectQuery().
 					WithArgs(tokenID).
 					WillReturnError(sql.ErrNoRows)
 			},
@@ -272,6 +292,9 @@ func TestRefreshTokenRepo_GetByID(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			repo, mock, cleanup := SetupTestRepo(t)
+			defer cleanup()
+
 			tt.mockFn(mock)
 
 			result, err := repo.GetByID(context.Background(), tt.tokenID)
@@ -293,10 +316,79 @@ func TestRefreshTokenRepo_GetByID(t *testing.T) {
 	}
 }
 
-func TestRefreshTokenRepo_MarkAsUsed(t *testing.T) {
-	repo, mock, cleanup := SetupTestRepo(t)
-	defer cleanup()
+func TestRefreshTokenRepo_GetByLookupHash(t *testing.T) {
+	expectedToken := createTestToken()
+	expectedToken.ID = 1
+
+	tests := []struct {
+		name    string
+		mockFn  func(sqlmock.Sqlmock)
+		wantErr bool
+		errMsg  string
+	}{
+		{
+			name: "successful get",
+			mockFn: func(m sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{
+					"id", "user_id", "token_hash", "user_agent", "ip_address",
+					"created_at", "expires_at", "is_used", "updated_at", "lookup_hash",
+				}).AddRow(
+					expectedToken.ID, expectedToken.UserID, expectedToken.TokenHash,
+					expectedToken.UserAgent, expectedToken.IPAddress, time.Now(),
+					expectedToken.ExpiresAt, expectedToken.IsUsed, time.Now(), expectedToken.LookupHash,
+				)
+				m.ExpectPrepare(`SELECT .+ FROM refresh_tokens WHERE lookup_hash = \$1`).ExpectQuery().
+					WithArgs(expectedToken.LookupHash).
+					WillReturnRows(rows)
+			},
+		},
+		{
+			name: "token not found",
+			mockFn: func(m sqlmock.Sqlmock) {
+				m.ExpectPrepare(`SELECT .+ FROM refresh_tokens WHERE lookup_hash = \$1`).ExpectQuery().
+					WithArgs(expectedToken.LookupHash).
+					WillReturnError(sql.ErrNoRows)
+			},
+			wantErr: true,
+			errMsg:  "refresh token not found",
+		},
+		{
+			name: "database error",
+			mockFn: func(m sqlmock.Sqlmock) {
+				m.ExpectPrepare(`SELECT .+ FROM refresh_tokens WHERE lookup_hash = \$1`).ExpectQuery().
+					WithArgs(expectedToken.LookupHash).
+					WillReturnError(fmt.Errorf("connection lost"))
+			},
+			wantErr: true,
+			errMsg:  "failed to get refresh token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock, cleanup := SetupTestRepo(t)
+			defer cleanup()
+
+			tt.mockFn(mock)
+
+			result, err := repo.GetByLookupHash(context.Background(), expectedToken.LookupHash)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Nil(t, result)
+				assert.Contains(t, err.Error(), tt.errMsg)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, expectedToken.ID, result.ID)
+				assert.Equal(t, expectedToken.LookupHash, result.LookupHash)
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
 
+func TestRefreshTokenRepo_MarkAsUsed(t *testing.T) {
 	tokenID := 1
 
 	tests := []struct {
@@ -310,28 +402,28 @@ func TestRefreshTokenRepo_MarkAsUsed(t *testing.T) {
 			name:    "successful mark as used",
 			tokenID: tokenID,
 			mockFn: func(m sqlmock.Sqlmock) {
-				m.ExpectExec(`UPDATE refresh_tokens SET is_used = true`).
+				m.ExpectPrepare(`UPDATE refresh_tokens SET is_used = true`).ExpectExec().
 					WithArgs(tokenID).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 			},
 			wantErr: false,
 		},
 		{
-			name:    "token not found",
+			name:    "token not found or used already",
 			tokenID: tokenID,
 			mockFn: func(m sqlmock.Sqlmock) {
-				m.ExpectExec(`UPDATE refresh_tokens SET is_used = true`).
+				m.ExpectPrepare(`UPDATE refresh_tokens SET is_used = true, updated_at = NOW\(\)\s+WHERE id = \$1 AND is_used = false`).ExpectExec().
 					WithArgs(tokenID).
 					WillReturnResult(sqlmock.NewResult(0, 0))
 			},
 			wantErr: true,
-			errMsg:  "token with id 1 not found",
+			errMsg:  "token with id 1: refresh token used already or not found",
 		},
 		{
 			name:    "database error",
 			tokenID: tokenID,
 			mockFn: func(m sqlmock.Sqlmock) {
-				m.ExpectExec(`UPDATE refresh_tokens SET is_used = true`).
+				m.ExpectPrepare(`UPDATE refresh_tokens SET is_used = true`).ExpectExec().
 					WithArgs(tokenID).
 					WillReturnError(fmt.Errorf("database error"))
 			},
@@ -342,6 +434,9 @@ func TestRefreshTokenRepo_MarkAsUsed(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			repo, mock, cleanup := SetupTestRepo(t)
+			defer cleanup()
+
 			tt.mockFn(mock)
 
 			err := repo.MarkAsUsed(context.Background(), tt.tokenID)
@@ -361,9 +456,6 @@ func TestRefreshTokenRepo_MarkAsUsed(t *testing.T) {
 }
 
 func TestRefreshTokenRepo_Delete(t *testing.T) {
-	repo, mock, cleanup := SetupTestRepo(t)
-	defer cleanup()
-
 	tokenID := 1
 
 	tests := []struct {
@@ -377,7 +469,7 @@ func TestRefreshTokenRepo_Delete(t *testing.T) {
 			name:    "successful delete",
 			tokenID: tokenID,
 			mockFn: func(m sqlmock.Sqlmock) {
-				m.ExpectExec(`DELETE FROM refresh_tokens WHERE id = \$1`).
+				m.ExpectPrepare(`DELETE FROM refresh_tokens WHERE id = \$1`).ExpectExec().
 					WithArgs(tokenID).
 					WillReturnResult(sqlmock.NewResult(0, 1))
 			},
@@ -387,7 +479,7 @@ func TestRefreshTokenRepo_Delete(t *testing.T) {
 			name:    "token not found",
 			tokenID: tokenID,
 			mockFn: func(m sqlmock.Sqlmock) {
-				m.ExpectExec(`DELETE FROM refresh_tokens WHERE id = \$1`).
+				m.ExpectPrepare(`DELETE FROM refresh_tokens WHERE id = \$1`).ExpectExec().
 					WithArgs(tokenID).
 					WillReturnResult(sqlmock.NewResult(0, 0))
 			},
@@ -398,7 +490,7 @@ func TestRefreshTokenRepo_Delete(t *testing.T) {
 			name:    "database error",
 			tokenID: tokenID,
 			mockFn: func(m sqlmock.Sqlmock) {
-				m.ExpectExec(`DELETE FROM refresh_tokens WHERE id = \$1`).
+				m.ExpectPrepare(`DELETE FROM refresh_tokens WHERE id = \$1`).ExpectExec().
 					WithArgs(tokenID).
 					WillReturnError(fmt.Errorf("database error"))
 			},
@@ -409,6 +501,9 @@ func TestRefreshTokenRepo_Delete(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			repo, mock, cleanup := SetupTestRepo(t)
+			defer cleanup()
+
 			tt.mockFn(mock)
 
 			err := repo.Delete(context.Background(), tt.tokenID)
@@ -428,9 +523,6 @@ func TestRefreshTokenRepo_Delete(t *testing.T) {
 }
 
 func TestRefreshTokenRepo_DeleteAllByUserID(t *testing.T) {
-	repo, mock, cleanup := SetupTestRepo(t)
-	defer cleanup()
-
 	userID := "test-user-id"
 
 	tests := []struct {
@@ -444,7 +536,7 @@ func TestRefreshTokenRepo_DeleteAllByUserID(t *testing.T) {
 			name:   "successful delete all",
 			userID: userID,
 			mockFn: func(m sqlmock.Sqlmock) {
-				m.ExpectExec(`DELETE FROM refresh_tokens WHERE user_id = \$1`).
+				m.ExpectPrepare(`DELETE FROM refresh_tokens WHERE user_id = \$1`).ExpectExec().
 					WithArgs(userID).
 					WillReturnResult(sqlmock.NewResult(0, 3))
 			},
@@ -454,7 +546,7 @@ func TestRefreshTokenRepo_DeleteAllByUserID(t *testing.T) {
 			name:   "database error",
 			userID: userID,
 			mockFn: func(m sqlmock.Sqlmock) {
-				m.ExpectExec(`DELETE FROM refresh_tokens WHERE user_id = \$1`).
+				m.ExpectPrepare(`DELETE FROM refresh_tokens WHERE user_id = \$1`).ExpectExec().
 					WithArgs(userID).
 					WillReturnError(fmt.Errorf("database error"))
 			},
@@ -465,6 +557,9 @@ func TestRefreshTokenRepo_DeleteAllByUserID(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			repo, mock, cleanup := SetupTestRepo(t)
+			defer cleanup()
+
 			tt.mockFn(mock)
 
 			err := repo.DeleteAllByUserID(context.Background(), tt.userID)
@@ -484,9 +579,6 @@ func TestRefreshTokenRepo_DeleteAllByUserID(t *testing.T) {
 }
 
 func TestRefreshTokenRepo_CleanExpired(t *testing.T) {
-	repo, mock, cleanup := SetupTestRepo(t)
-	defer cleanup()
-
 	tests := []struct {
 		name     string
 		mockFn   func(sqlmock.Sqlmock)
@@ -497,7 +589,7 @@ func TestRefreshTokenRepo_CleanExpired(t *testing.T) {
 		{
 			name: "successful clean",
 			mockFn: func(m sqlmock.Sqlmock) {
-				m.ExpectExec(`DELETE FROM refresh_tokens WHERE expires_at < NOW\(\)`).
+				m.ExpectPrepare(`DELETE FROM refresh_tokens WHERE expires_at < NOW\(\)`).ExpectExec().
 					WillReturnResult(sqlmock.NewResult(0, 5))
 			},
 			want:    5,
@@ -506,7 +598,7 @@ func TestRefreshTokenRepo_CleanExpired(t *testing.T) {
 		{
 			name: "no expired tokens",
 			mockFn: func(m sqlmock.Sqlmock) {
-				m.ExpectExec(`DELETE FROM refresh_tokens WHERE expires_at < NOW\(\)`).
+				m.ExpectPrepare(`DELETE FROM refresh_tokens WHERE expires_at < NOW\(\)`).ExpectExec().
 					WillReturnResult(sqlmock.NewResult(0, 0))
 			},
 			want:    0,
@@ -515,7 +607,7 @@ func TestRefreshTokenRepo_CleanExpired(t *testing.T) {
 		{
 			name: "database error",
 			mockFn: func(m sqlmock.Sqlmock) {
-				m.ExpectExec(`DELETE FROM refresh_tokens WHERE expires_at < NOW\(\)`).
+				m.ExpectPrepare(`DELETE FROM refresh_tokens WHERE expires_at < NOW\(\)`).ExpectExec().
 					WillReturnError(fmt.Errorf("database error"))
 			},
 			want:    0,
@@ -526,6 +618,9 @@ func TestRefreshTokenRepo_CleanExpired(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			repo, mock, cleanup := SetupTestRepo(t)
+			defer cleanup()
+
 			tt.mockFn(mock)
 
 			result, err := repo.CleanExpired(context.Background())
@@ -546,10 +641,54 @@ func TestRefreshTokenRepo_CleanExpired(t *testing.T) {
 	}
 }
 
-func TestRefreshTokenRepo_GetAllActiveByUserID(t *testing.T) {
-	repo, mock, cleanup := SetupTestRepo(t)
-	defer cleanup()
+func TestRefreshTokenRepo_CountActive(t *testing.T) {
+	tests := []struct {
+		name    string
+		mockFn  func(sqlmock.Sqlmock)
+		want    int64
+		wantErr bool
+	}{
+		{
+			name: "active tokens",
+			mockFn: func(m sqlmock.Sqlmock) {
+				m.ExpectPrepare(`SELECT COUNT\(\*\) FROM refresh_tokens WHERE expires_at > NOW\(\) AND is_used = false`).ExpectQuery().
+					WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+			},
+			want: 7,
+		},
+		{
+			name: "database error",
+			mockFn: func(m sqlmock.Sqlmock) {
+				m.ExpectPrepare(`SELECT COUNT\(\*\) FROM refresh_tokens`).ExpectQuery().
+					WillReturnError(fmt.Errorf("database error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock, cleanup := SetupTestRepo(t)
+			defer cleanup()
+
+			tt.mockFn(mock)
 
+			result, err := repo.CountActive(context.Background())
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), "failed to count active tokens")
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, result)
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRefreshTokenRepo_GetAllActiveByUserID(t *testing.T) {
 	userID := "test-user-id"
 	token1 := createTestToken()
 	token1.ID = 1
@@ -582,7 +721,7 @@ func TestRefreshTokenRepo_GetAllActiveByUserID(t *testing.T) {
 					AddRow(token2.ID, token2.UserID, token2.TokenHash, token2.UserAgent,
 						token2.IPAddress, token2.CreatedAt, token2.ExpiresAt, token2.IsUsed, token2.UpdatedAt)
 
-				m.ExpectQuery(`SELECT .+ FROM refresh_tokens WHERE user_id = \$1`).
+				m.ExpectPrepare(`SELECT .+ FROM refresh_tokens WHERE user_id = \$1`).ExpectQuery().
 					WithArgs(userID).
 					WillReturnRows(rows)
 			},
@@ -597,7 +736,7 @@ func TestRefreshTokenRepo_GetAllActiveByUserID(t *testing.T) {
 					"id", "user_id", "token_hash", "user_agent", "ip_address",
 					"created_at", "expires_at", "is_used", "updated_at",
 				})
-				m.ExpectQuery(`SELECT .+ FROM refresh_tokens WHERE user_id = \$1`).
+				m.ExpectPrepare(`SELECT .+ FROM refresh_tokens WHERE user_id = \$1`).ExpectQuery().
 					WithArgs(userID).
 					WillReturnRows(rows)
 			},
@@ -608,7 +747,7 @@ func TestRefreshTokenRepo_GetAllActiveByUserID(t *testing.T) {
 			name:   "database error",
 			userID: userID,
 			mockFn: func(m sqlmock.Sqlmock) {
-				m.ExpectQuery(`SELECT .+ FROM refresh_tokens WHERE user_id = \$1`).
+				m.ExpectPrepare(`SELECT .+ FROM refresh_tokens WHERE user_id = \$1`).ExpectQuery().
 					WithArgs(userID).
 					WillReturnError(fmt.Errorf("database error"))
 			},
@@ -620,6 +759,9 @@ func TestRefreshTokenRepo_GetAllActiveByUserID(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			repo, mock, cleanup := SetupTestRepo(t)
+			defer cleanup()
+
 			tt.mockFn(mock)
 
 			result, err := repo.GetAllActiveByUserID(context.Background(), tt.userID)
@@ -653,4 +795,422 @@ func TestRefreshTokenRepo_Close(t *testing.T) {
 	err := repo.Close()
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
-}
\ No newline at end of file
+}
+
+func TestRefreshTokenRepo_CheckMigrations(t *testing.T) {
+	migrationsPath := t.TempDir()
+	for _, name := range []string{"000001_jwt.up.sql", "000001_jwt.down.sql", "000002_lookup.up.sql", "000002_lookup.down.sql"} {
+		require.NoError(t, os.WriteFile(filepath.Join(migrationsPath, name), []byte("SELECT 1;"), 0o600))
+	}
+
+	tests := []struct {
+		name    string
+		mockFn  func(sqlmock.Sqlmock)
+		wantErr string
+	}{
+		{
+			name: "up to date",
+			mockFn: func(m sqlmock.Sqlmock) {
+				m.ExpectQuery(`SELECT version, dirty FROM schema_migrations`).
+					WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(2, false))
+			},
+		},
+		{
+			name: "pending migrations",
+			mockFn: func(m sqlmock.Sqlmock) {
+				m.ExpectQuery(`SELECT version, dirty FROM schema_migrations`).
+					WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(1, false))
+			},
+			wantErr: "schema version is 1, latest is 2",
+		},
+		{
+			name: "dirty migration",
+			mockFn: func(m sqlmock.Sqlmock) {
+				m.ExpectQuery(`SELECT version, dirty FROM schema_migrations`).
+					WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}).AddRow(2, true))
+			},
+			wantErr: "migration 2 is dirty",
+		},
+		{
+			name: "no migrations applied",
+			mockFn: func(m sqlmock.Sqlmock) {
+				m.ExpectQuery(`SELECT version, dirty FROM schema_migrations`).
+					WillReturnRows(sqlmock.NewRows([]string{"version", "dirty"}))
+			},
+			wantErr: "schema version is 0, latest is 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock, cleanup := SetupTestRepo(t)
+			defer cleanup()
+
+			tt.mockFn(mock)
+
+			err := repo.CheckMigrations(context.Background(), migrationsPath)
+
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestRefreshTokenRepo_DeleteBatches(t *testing.T) {
+	repo, mock, cleanup := SetupTestRepo(t)
+	defer cleanup()
+
+	usedBefore := time.Now().Add(-24 * time.Hour)
+
+	mock.ExpectPrepare(`DELETE FROM refresh_tokens\s+WHERE id IN \(SELECT id FROM refresh_tokens WHERE expires_at < NOW\(\) LIMIT \$1\)`).ExpectExec().
+		WithArgs(100).
+		WillReturnResult(sqlmock.NewResult(0, 100))
+	mock.ExpectPrepare(`DELETE FROM refresh_tokens\s+WHERE id IN \(SELECT id FROM refresh_tokens WHERE is_used = true AND updated_at < \$1 LIMIT \$2\)`).ExpectExec().
+		WithArgs(usedBefore, 100).
+		WillReturnResult(sqlmock.NewResult(0, 12))
+	// The statement prepared by the first call is reused
+	mock.ExpectExec(`DELETE FROM refresh_tokens`).
+		WithArgs(100).
+		WillReturnError(fmt.Errorf("database error"))
+
+	n, err := repo.DeleteExpiredBatch(context.Background(), 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), n)
+
+	n, err = repo.DeleteUsedBatch(context.Background(), usedBefore, 100)
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), n)
+
+	_, err = repo.DeleteExpiredBatch(context.Background(), 100)
+	assert.ErrorContains(t, err, "failed to delete expired tokens")
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshTokenRepo_TryLock(t *testing.T) {
+	tests := []struct {
+		name          string
+		mockFn        func(sqlmock.Sqlmock)
+		wantAcquired  bool
+		wantErr       bool
+		wantUnlockErr bool
+		// wantOpenConns is the number of connections left in the pool after the unlock
+		wantOpenConns int
+	}{
+		{
+			name: "acquired and released",
+			mockFn: func(m sqlmock.Sqlmock) {
+				m.ExpectQuery(`SELECT pg_try_advisory_lock\(\$1\)`).WithArgs(int64(42)).
+					WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(true))
+				m.ExpectExec(`SELECT pg_advisory_unlock\(\$1\)`).WithArgs(int64(42)).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			wantAcquired:  true,
+			wantOpenConns: 1,
+		},
+		{
+			name: "failed release discards the connection",
+			mockFn: func(m sqlmock.Sqlmock) {
+				m.ExpectQuery(`SELECT pg_try_advisory_lock\(\$1\)`).WithArgs(int64(42)).
+					WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(true))
+				m.ExpectExec(`SELECT pg_advisory_unlock\(\$1\)`).WithArgs(int64(42)).
+					WillReturnError(fmt.Errorf("canceling statement due to statement timeout"))
+			},
+			wantAcquired:  true,
+			wantUnlockErr: true,
+			wantOpenConns: 0,
+		},
+		{
+			name: "held by another session",
+			mockFn: func(m sqlmock.Sqlmock) {
+				m.ExpectQuery(`SELECT pg_try_advisory_lock\(\$1\)`).WithArgs(int64(42)).
+					WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(false))
+			},
+		},
+		{
+			name: "database error",
+			mockFn: func(m sqlmock.Sqlmock) {
+				m.ExpectQuery(`SELECT pg_try_advisory_lock\(\$1\)`).WithArgs(int64(42)).
+					WillReturnError(fmt.Errorf("database error"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mock, cleanup := SetupTestRepo(t)
+			defer cleanup()
+			tt.mockFn(mock)
+
+			unlock, acquired, err := repo.TryLock(context.Background(), 42)
+
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "failed to take advisory lock")
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantAcquired, acquired)
+			if acquired {
+				err := unlock()
+				if tt.wantUnlockErr {
+					assert.ErrorContains(t, err, "failed to release advisory lock")
+				} else {
+					assert.NoError(t, err)
+				}
+				assert.Equal(t, tt.wantOpenConns, repo.db.Stats().OpenConnections)
+			}
+
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestDSNFromConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.DatabaseConfig
+		want string
+	}{
+		{
+			name: "built from settings",
+			cfg: config.DatabaseConfig{
+				Host: "db", Port: "5432", User: "auth", Password: "secret", DBName: "jwt", SSLMode: "require",
+			},
+			want: "host=db port=5432 user=auth password=secret dbname=jwt sslmode=require",
+		},
+		{
+			name: "built from settings with statement timeout",
+			cfg: config.DatabaseConfig{
+				Host: "db", Port: "5432", User: "auth", Password: "secret", DBName: "jwt", SSLMode: "require",
+				StatementTimeout: config.Duration(5 * time.Second),
+			},
+			want: "host=db port=5432 user=auth password=secret dbname=jwt sslmode=require statement_timeout=5000",
+		},
+		{
+			name: "url override with statement timeout",
+			cfg: config.DatabaseConfig{
+				DSN:              "postgres://auth:secret@db:5432/jwt?sslmode=require",
+				Host:             "ignored",
+				StatementTimeout: config.Duration(250 * time.Millisecond),
+			},
+			want: "postgres://auth:secret@db:5432/jwt?sslmode=require&statement_timeout=250",
+		},
+		{
+			name: "key value override",
+			cfg:  config.DatabaseConfig{DSN: "host=db dbname=jwt"},
+			want: "host=db dbname=jwt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsn, err := dsnFromConfig(tt.cfg)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, dsn)
+		})
+	}
+}
+
+func TestPing_Retries(t *testing.T) {
+	tests := []struct {
+		name    string
+		retries int
+		failing int
+		wantErr bool
+	}{
+		{name: "database up", retries: 3, failing: 0},
+		{name: "database starting", retries: 3, failing: 2},
+		{name: "database down", retries: 2, failing: 3, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+			require.NoError(t, err)
+			defer db.Close()
+
+			for i := 0; i < tt.failing; i++ {
+				mock.ExpectPing().WillReturnError(fmt.Errorf("connection refused"))
+			}
+			if !tt.wantErr {
+				mock.ExpectPing()
+			}
+
+			cfg := config.DatabaseConfig{ConnectRetries: tt.retries, ConnectBackoff: config.Duration(time.Millisecond)}
+			err = ping(context.Background(), sqlx.NewDb(db, "postgres"), cfg, &mockLogger{})
+
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestPing_Cancelled(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectPing().WillReturnError(fmt.Errorf("connection refused"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	cfg := config.DatabaseConfig{ConnectRetries: 5, ConnectBackoff: config.Duration(time.Hour)}
+	start := time.Now()
+	err = ping(ctx, sqlx.NewDb(db, "postgres"), cfg, &mockLogger{})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), time.Second, "the backoff is interrupted")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshTokenRepo_ReadRouting(t *testing.T) {
+	repo, primary, cleanup := SetupTestRepo(t)
+	defer cleanup()
+
+	replicaDB, replica, err := sqlmock.New()
+	require.NoError(t, err)
+	defer replicaDB.Close()
+	repo.replicas = []*stmtCache{newStmtCache(sqlx.NewDb(replicaDB, "postgres"))}
+
+	countRows := func() *sqlmock.Rows { return sqlmock.NewRows([]string{"count"}).AddRow(1) }
+
+	// Reads go to the replica, writes and reads of the writer's context to the primary
+	replica.ExpectPrepare(`SELECT COUNT\(\*\) FROM refresh_tokens`).ExpectQuery().WillReturnRows(countRows())
+	primary.ExpectPrepare(`UPDATE refresh_tokens`).ExpectExec().WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	primary.ExpectPrepare(`SELECT COUNT\(\*\) FROM refresh_tokens`).ExpectQuery().WillReturnRows(countRows())
+
+	_, err = repo.CountActive(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, repo.MarkAsUsed(context.Background(), 1))
+	_, err = repo.CountActive(ReadYourWrites(context.Background()))
+	require.NoError(t, err)
+
+	assert.NoError(t, primary.ExpectationsWereMet())
+	assert.NoError(t, replica.ExpectationsWereMet())
+}
+
+func TestRefreshTokenRepo_PreparedStatementsReused(t *testing.T) {
+	repo, mock, cleanup := SetupTestRepo(t)
+	defer cleanup()
+
+	rows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{
+			"id", "user_id", "token_hash", "user_agent", "ip_address", "created_at", "expires_at", "is_used", "updated_at",
+		}).AddRow(1, "test-user-id", "hash", "agent", "127.0.0.1", time.Now(), time.Now(), false, time.Now())
+	}
+
+	mock.ExpectPrepare(`SELECT (.+) FROM refresh_tokens\s+WHERE id = \$1`).WillBeClosed().
+		ExpectQuery().WithArgs(1).WillReturnRows(rows())
+	mock.ExpectQuery(`SELECT (.+) FROM refresh_tokens\s+WHERE id = \$1`).WithArgs(2).WillReturnRows(rows())
+	mock.ExpectClose()
+
+	_, err := repo.GetByID(context.Background(), 1)
+	require.NoError(t, err)
+	_, err = repo.GetByID(context.Background(), 2)
+	require.NoError(t, err)
+	require.NoError(t, repo.Close())
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Mock statement recording whether it was closed
+type mockStmt struct {
+	closed bool
+}
+
+func (m *mockStmt) Close() error {
+	m.closed = true
+	return nil
+}
+
+func TestStmtCache_PreparesOutsideTheLock(t *testing.T) {
+	var mu sync.RWMutex
+	cachedStmt := &mockStmt{}
+	stmts := map[string]*mockStmt{"cached": cachedStmt}
+
+	preparing := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan *mockStmt)
+	duplicate := &mockStmt{}
+	go func() {
+		stmt, _ := cached(&mu, stmts, "slow", func() (*mockStmt, error) {
+			close(preparing)
+			<-release
+			return duplicate, nil
+		})
+		done <- stmt
+	}()
+	<-preparing
+
+	// A cached statement is returned while another one is being prepared
+	stmt, err := cached(&mu, stmts, "cached", func() (*mockStmt, error) {
+		t.Error("a cached statement is prepared again")
+		return nil, nil
+	})
+	require.NoError(t, err)
+	assert.Same(t, cachedStmt, stmt)
+
+	// The statement stored first wins, the other one is closed
+	winner, err := cached(&mu, stmts, "slow", func() (*mockStmt, error) { return &mockStmt{}, nil })
+	require.NoError(t, err)
+	close(release)
+	loser := <-done
+
+	assert.Same(t, winner, loser)
+	assert.Same(t, winner, stmts["slow"])
+	assert.False(t, winner.closed)
+	assert.True(t, duplicate.closed)
+}
+
+func TestStmtCache_FailedPrepareNotCached(t *testing.T) {
+	var mu sync.RWMutex
+	stmts := map[string]*mockStmt{}
+
+	_, err := cached(&mu, stmts, "query", func() (*mockStmt, error) { return nil, errors.New("connection refused") })
+	require.EqualError(t, err, "connection refused")
+	assert.Empty(t, stmts)
+
+	stmt, err := cached(&mu, stmts, "query", func() (*mockStmt, error) { return &mockStmt{}, nil })
+	require.NoError(t, err)
+	assert.Same(t, stmt, stmts["query"])
+}
+
+func TestRefreshTokenRepo_QuerySpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	repo, mock, cleanup := SetupTestRepo(t)
+	defer cleanup()
+
+	mock.ExpectPrepare(`SELECT .+ FROM refresh_tokens WHERE id = \$1`).ExpectQuery().
+		WithArgs(1).
+		WillReturnError(fmt.Errorf("connection reset"))
+
+	_, err := repo.GetByID(context.Background(), 1)
+	require.Error(t, err)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "postgres.get_by_id", span.Name())
+	assert.Equal(t, trace.SpanKindClient, span.SpanKind())
+	assert.Contains(t, span.Attributes(), attribute.String("db.system", "postgresql"))
+	assert.Contains(t, span.Attributes(), attribute.String("db.operation.name", "get_by_id"))
+	assert.Contains(t, span.Attributes(), attribute.String("db.query.text",
+		"SELECT id, user_id, token_hash, user_agent, ip_address, created_at, expires_at, is_used, updated_at FROM refresh_tokens WHERE id = $1"))
+	assert.Equal(t, codes.Error, span.Status().Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
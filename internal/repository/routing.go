@@ -0,0 +1,26 @@
+package repository
+
+import "context"
+
+type readYourWritesKey struct{}
+
+// ReadYourWrites returns a context whose read-only queries go to the primary, for flows reading data
+// they have just written, which the replicas may not have received yet
+func ReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readYourWritesKey{}, true)
+}
+
+func readsFromPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(readYourWritesKey{}).(bool)
+	return primary
+}
+
+// reader returns the statements of a read-only query: the replicas in turn, or the primary if there are none
+// or ctx requires reading its writes. Writes and token rotations always use r.stmts.
+func (r *refreshTokenRepo) reader(ctx context.Context) *stmtCache {
+	if len(r.replicas) == 0 || readsFromPrimary(ctx) {
+		return r.stmts
+	}
+	n := r.next.Add(1)
+	return r.replicas[n%uint64(len(r.replicas))]
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// stmtCache prepares the statements of a pool on first use and reuses them, saving a round trip per query.
+// Statements are prepared outside the lock, so that a slow prepare doesn't block the queries of cached statements;
+// concurrent first uses of a query may prepare it twice, the statement stored first wins and the others are closed.
+// A failed prepare is not cached and is retried by the next query.
+//
+// Statements are never evicted, not even on driver.ErrBadConn: a database/sql statement belongs to the pool,
+// which discards a bad connection and prepares the statement again on the next connection it runs on, so that
+// a cached statement stays usable after connections are lost or recycled.
+type stmtCache struct {
+	db *sqlx.DB
+
+	mu    sync.RWMutex
+	stmts map[string]*sqlx.Stmt
+	named map[string]*sqlx.NamedStmt
+}
+
+func newStmtCache(db *sqlx.DB) *stmtCache {
+	return &stmtCache{
+		db:    db,
+		stmts: make(map[string]*sqlx.Stmt),
+		named: make(map[string]*sqlx.NamedStmt),
+	}
+}
+
+// prepare returns the prepared statement of query
+func (c *stmtCache) prepare(ctx context.Context, query string) (*sqlx.Stmt, error) {
+	return cached(&c.mu, c.stmts, query, func() (*sqlx.Stmt, error) {
+		return c.db.PreparexContext(ctx, query)
+	})
+}
+
+// prepareNamed returns the prepared statement of a query with named parameters
+func (c *stmtCache) prepareNamed(ctx context.Context, query string) (*sqlx.NamedStmt, error) {
+	return cached(&c.mu, c.named, query, func() (*sqlx.NamedStmt, error) {
+		return c.db.PrepareNamedContext(ctx, query)
+	})
+}
+
+// cached returns the statement of query from stmts, preparing and storing it if it is missing
+func cached[S io.Closer](mu *sync.RWMutex, stmts map[string]S, query string, prepare func() (S, error)) (S, error) {
+	mu.RLock()
+	stmt, ok := stmts[query]
+	mu.RUnlock()
+	if ok {
+		return stmt, nil
+	}
+
+	stmt, err := prepare()
+	if err != nil {
+		return stmt, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if existing, ok := stmts[query]; ok {
+		_ = stmt.Close()
+		return existing, nil
+	}
+	stmts[query] = stmt
+
+	return stmt, nil
+}
+
+// get runs the prepared statement of query and scans the row into dest, see sqlx.Stmt.GetContext
+func (c *stmtCache) get(ctx context.Context, dest any, query string, args ...any) error {
+	stmt, err := c.prepare(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to prepare query: %w", err)
+	}
+	return stmt.GetContext(ctx, dest, args...)
+}
+
+// selectAll runs the prepared statement of query and scans the rows into dest, see sqlx.Stmt.SelectContext
+func (c *stmtCache) selectAll(ctx context.Context, dest any, query string, args ...any) error {
+	stmt, err := c.prepare(ctx, query)
+	if err != nil {
+		return fmt.Errorf("failed to prepare query: %w", err)
+	}
+	return stmt.SelectContext(ctx, dest, args...)
+}
+
+// exec runs the prepared statement of query
+func (c *stmtCache) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	stmt, err := c.prepare(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare query: %w", err)
+	}
+	return stmt.ExecContext(ctx, args...)
+}
+
+// close closes the statements and the pool
+func (c *stmtCache) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	for query, stmt := range c.stmts {
+		errs = append(errs, stmt.Close())
+		delete(c.stmts, query)
+	}
+	for query, stmt := range c.named {
+		errs = append(errs, stmt.Close())
+		delete(c.named, query)
+	}
+	errs = append(errs, c.db.Close())
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AtoyanMikhail/auth/internal/config"
+	"github.com/AtoyanMikhail/auth/internal/logger"
+	"github.com/AtoyanMikhail/auth/internal/metrics"
+	"github.com/AtoyanMikhail/auth/internal/repository/models"
+	"github.com/AtoyanMikhail/auth/internal/tokenhash"
+)
+
+// refreshTokenLength is the number of random bytes of a refresh token
+const refreshTokenLength = 32
+
+var (
+	// ErrInvalidToken is returned by Refresh if the token is unknown, expired or used already
+	ErrInvalidToken = errors.New("invalid refresh token")
+	// ErrUserAgentMismatch is returned by Refresh if the token was issued to another User-Agent,
+	// in which case every token of the user is revoked
+	ErrUserAgentMismatch = errors.New("user agent does not match the refresh token")
+)
+
+// Store is the part of the refresh token repository used by the service
+type Store interface {
+	Create(ctx context.Context, token *models.RefreshToken) error
+	GetByLookupHash(ctx context.Context, lookupHash string) (*models.RefreshToken, error)
+	MarkAsUsed(ctx context.Context, tokenID int) error
+	DeleteAllByUserID(ctx context.Context, userID string) error
+}
+
+// RefreshTokenService issues, rotates and revokes refresh tokens. Tokens are opaque random strings,
+// only their hashes are stored, see tokenhash.Hasher.
+type RefreshTokenService struct {
+	store  Store
+	hasher *tokenhash.Hasher
+	jwt    func() config.JWTConfig
+	l      logger.Logger
+	now    func() time.Time
+}
+
+// NewRefreshTokenService creates a service storing the tokens in store. jwt returns the current JWT settings,
+// so that a reloaded token TTL applies to the next token issued.
+func NewRefreshTokenService(store Store, hasher *tokenhash.Hasher, jwt func() config.JWTConfig, l logger.Logger) *RefreshTokenService {
+	return &RefreshTokenService{store: store, hasher: hasher, jwt: jwt, l: l, now: time.Now}
+}
+
+// Issue creates a refresh token of userID and returns it
+func (s *RefreshTokenService) Issue(ctx context.Context, userID, userAgent, ipAddress string) (string, error) {
+	b := make([]byte, refreshTokenLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	hash, err := s.hasher.Hash(token)
+	if err != nil {
+		return "", err
+	}
+
+	err = s.store.Create(ctx, &models.RefreshToken{
+		UserID:     userID,
+		TokenHash:  hash,
+		LookupHash: s.hasher.Lookup(token),
+		UserAgent:  userAgent,
+		IPAddress:  ipAddress,
+		ExpiresAt:  s.now().Add(time.Duration(s.jwt().RefreshTokenTTL)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	metrics.TokensIssued.Inc()
+	return token, nil
+}
+
+// Refresh exchanges token for a new refresh token of the same user, returned along with the user ID.
+// The token is marked as used, so that it can't be exchanged again.
+func (s *RefreshTokenService) Refresh(ctx context.Context, token, userAgent, ipAddress string) (newToken, userID string, err error) {
+	newToken, userID, reason, err := s.refresh(ctx, token, userAgent, ipAddress)
+	if err != nil {
+		metrics.RefreshFailures.WithLabelValues(reason).Inc()
+		return "", "", err
+	}
+
+	metrics.TokensRefreshed.Inc()
+	return newToken, userID, nil
+}
+
+// refresh exchanges token, returning the reason of the failure as reported by metrics.RefreshFailures
+func (s *RefreshTokenService) refresh(ctx context.Context, token, userAgent, ipAddress string) (newToken, userID, reason string, err error) {
+	if token == "" {
+		return "", "", metrics.RefreshFailureInvalid, ErrInvalidToken
+	}
+
+	stored, err := s.store.GetByLookupHash(ctx, s.hasher.Lookup(token))
+	if errors.Is(err, models.ErrTokenNotFound) {
+		return "", "", metrics.RefreshFailureNotFound, ErrInvalidToken
+	}
+	if err != nil {
+		return "", "", metrics.RefreshFailureDBError, err
+	}
+
+	// The token is replaced by a new one hashed with the current algorithm, so an outdated hash needs no rehash
+	if _, err := s.hasher.Verify(token, stored.TokenHash); err != nil {
+		if errors.Is(err, tokenhash.ErrMismatch) {
+			return "", "", metrics.RefreshFailureInvalid, ErrInvalidToken
+		}
+		return "", "", metrics.RefreshFailureInvalid, fmt.Errorf("failed to verify refresh token: %w", err)
+	}
+	if stored.IsUsed || !s.now().Before(stored.ExpiresAt) {
+		return "", "", metrics.RefreshFailureInvalid, ErrInvalidToken
+	}
+
+	if stored.UserAgent != userAgent {
+		logger.FromContextOr(ctx, s.l).Warn("Refresh from another user agent, revoking the tokens of the user",
+			logger.String("user_id", stored.UserID))
+		if err := s.store.DeleteAllByUserID(ctx, stored.UserID); err != nil {
+			return "", "", metrics.RefreshFailureUserAgent, errors.Join(ErrUserAgentMismatch, err)
+		}
+		return "", "", metrics.RefreshFailureUserAgent, ErrUserAgentMismatch
+	}
+
+	// A concurrent refresh with the same token may have passed the checks above as well, only one of them
+	// marks the token as used
+	if err := s.store.MarkAsUsed(ctx, stored.ID); err != nil {
+		if errors.Is(err, models.ErrTokenUsed) {
+			return "", "", metrics.RefreshFailureInvalid, ErrInvalidToken
+		}
+		return "", "", metrics.RefreshFailureDBError, err
+	}
+
+	newToken, err = s.Issue(ctx, stored.UserID, userAgent, ipAddress)
+	if err != nil {
+		return "", "", metrics.RefreshFailureDBError, err
+	}
+
+	return newToken, stored.UserID, "", nil
+}
+
+// Logout revokes every refresh token of userID
+func (s *RefreshTokenService) Logout(ctx context.Context, userID string) error {
+	if err := s.store.DeleteAllByUserID(ctx, userID); err != nil {
+		return err
+	}
+
+	metrics.Logouts.Inc()
+	return nil
+}
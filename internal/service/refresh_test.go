@@ -0,0 +1,292 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/AtoyanMikhail/auth/internal/config"
+	"github.com/AtoyanMikhail/auth/internal/logger"
+	"github.com/AtoyanMikhail/auth/internal/metrics"
+	"github.com/AtoyanMikhail/auth/internal/repository/models"
+	"github.com/AtoyanMikhail/auth/internal/tokenhash"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Mock store keeping the tokens by lookup hash
+type mockStore struct {
+	tokens    map[string]*models.RefreshToken
+	nextID    int
+	getErr    error
+	markErr   error
+	deleted   []string
+	deleteErr error
+	// afterGet runs after GetByLookupHash, e.g. to simulate a concurrent refresh
+	afterGet func()
+}
+
+func newMockStore() *mockStore {
+	return &mockStore{tokens: map[string]*models.RefreshToken{}}
+}
+
+func (m *mockStore) Create(ctx context.Context, token *models.RefreshToken) error {
+	m.nextID++
+	token.ID = m.nextID
+	m.tokens[token.LookupHash] = token
+	return nil
+}
+
+func (m *mockStore) GetByLookupHash(ctx context.Context, lookupHash string) (*models.RefreshToken, error) {
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	token, ok := m.tokens[lookupHash]
+	if !ok {
+		return nil, models.ErrTokenNotFound
+	}
+	copied := *token
+	if m.afterGet != nil {
+		m.afterGet()
+	}
+	return &copied, nil
+}
+
+func (m *mockStore) MarkAsUsed(ctx context.Context, tokenID int) error {
+	if m.markErr != nil {
+		return m.markErr
+	}
+	for _, token := range m.tokens {
+		if token.ID == tokenID && !token.IsUsed {
+			token.IsUsed = true
+			return nil
+		}
+	}
+	return fmt.Errorf("token with id %d: %w", tokenID, models.ErrTokenUsed)
+}
+
+func (m *mockStore) DeleteAllByUserID(ctx context.Context, userID string) error {
+	m.deleted = append(m.deleted, userID)
+	return m.deleteErr
+}
+
+func newTestService(t *testing.T, store Store, now time.Time) *RefreshTokenService {
+	hasher, err := tokenhash.New(config.TokenHashConfig{Algorithm: tokenhash.AlgorithmSHA256, Pepper: "test-pepper"})
+	require.NoError(t, err)
+
+	jwt := func() config.JWTConfig {
+		return config.JWTConfig{RefreshTokenTTL: config.Duration(24 * time.Hour)}
+	}
+	s := NewRefreshTokenService(store, hasher, jwt, logger.New(io.Discard))
+	s.now = func() time.Time { return now }
+	return s
+}
+
+func TestRefreshTokenService_Issue(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	store := newMockStore()
+	s := newTestService(t, store, now)
+
+	issued := testutil.ToFloat64(metrics.TokensIssued)
+	token, err := s.Issue(context.Background(), "user-id", "agent", "127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, issued+1, testutil.ToFloat64(metrics.TokensIssued))
+
+	stored, ok := store.tokens[s.hasher.Lookup(token)]
+	require.True(t, ok, "the token is stored by its lookup hash")
+	assert.Equal(t, "user-id", stored.UserID)
+	assert.Equal(t, now.Add(24*time.Hour), stored.ExpiresAt)
+	assert.NotContains(t, stored.TokenHash, token)
+	_, err = s.hasher.Verify(token, stored.TokenHash)
+	assert.NoError(t, err)
+
+	other, err := s.Issue(context.Background(), "user-id", "agent", "127.0.0.1")
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func TestRefreshTokenService_Issue_ReloadedTTL(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	store := newMockStore()
+	s := newTestService(t, store, now)
+
+	ttl := time.Hour
+	s.jwt = func() config.JWTConfig { return config.JWTConfig{RefreshTokenTTL: config.Duration(ttl)} }
+
+	token, err := s.Issue(context.Background(), "user-id", "agent", "127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(time.Hour), store.tokens[s.hasher.Lookup(token)].ExpiresAt)
+
+	ttl = 2 * time.Hour
+	token, err = s.Issue(context.Background(), "user-id", "agent", "127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(2*time.Hour), store.tokens[s.hasher.Lookup(token)].ExpiresAt)
+}
+
+func TestRefreshTokenService_Refresh(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		prepare     func(t *testing.T, s *RefreshTokenService, store *mockStore, token string) string
+		userAgent   string
+		wantErr     error
+		wantErrMsg  string
+		wantDeleted []string
+		wantReason  string
+	}{
+		{
+			name:      "exchanges the token",
+			userAgent: "agent",
+		},
+		{
+			name: "unknown token",
+			prepare: func(t *testing.T, s *RefreshTokenService, store *mockStore, token string) string {
+				return "unknown"
+			},
+			userAgent:  "agent",
+			wantErr:    ErrInvalidToken,
+			wantReason: metrics.RefreshFailureNotFound,
+		},
+		{
+			name: "empty token",
+			prepare: func(t *testing.T, s *RefreshTokenService, store *mockStore, token string) string {
+				return ""
+			},
+			userAgent:  "agent",
+			wantErr:    ErrInvalidToken,
+			wantReason: metrics.RefreshFailureInvalid,
+		},
+		{
+			name: "hash mismatch",
+			prepare: func(t *testing.T, s *RefreshTokenService, store *mockStore, token string) string {
+				store.tokens[s.hasher.Lookup(token)].TokenHash = "$sha256$" + s.hasher.Lookup("other")
+				return token
+			},
+			userAgent:  "agent",
+			wantErr:    ErrInvalidToken,
+			wantReason: metrics.RefreshFailureInvalid,
+		},
+		{
+			name: "expired token",
+			prepare: func(t *testing.T, s *RefreshTokenService, store *mockStore, token string) string {
+				store.tokens[s.hasher.Lookup(token)].ExpiresAt = now
+				return token
+			},
+			userAgent:  "agent",
+			wantErr:    ErrInvalidToken,
+			wantReason: metrics.RefreshFailureInvalid,
+		},
+		{
+			name: "used token",
+			prepare: func(t *testing.T, s *RefreshTokenService, store *mockStore, token string) string {
+				store.tokens[s.hasher.Lookup(token)].IsUsed = true
+				return token
+			},
+			userAgent:  "agent",
+			wantErr:    ErrInvalidToken,
+			wantReason: metrics.RefreshFailureInvalid,
+		},
+		{
+			name:        "another user agent revokes the tokens of the user",
+			userAgent:   "other-agent",
+			wantErr:     ErrUserAgentMismatch,
+			wantDeleted: []string{"user-id"},
+			wantReason:  metrics.RefreshFailureUserAgent,
+		},
+		{
+			name: "store error",
+			prepare: func(t *testing.T, s *RefreshTokenService, store *mockStore, token string) string {
+				store.getErr = errors.New("connection refused")
+				return token
+			},
+			userAgent:  "agent",
+			wantErrMsg: "connection refused",
+			wantReason: metrics.RefreshFailureDBError,
+		},
+		{
+			name: "token used by a concurrent refresh",
+			prepare: func(t *testing.T, s *RefreshTokenService, store *mockStore, token string) string {
+				store.afterGet = func() {
+					require.NoError(t, store.MarkAsUsed(context.Background(), store.tokens[s.hasher.Lookup(token)].ID))
+				}
+				return token
+			},
+			userAgent:  "agent",
+			wantErr:    ErrInvalidToken,
+			wantReason: metrics.RefreshFailureInvalid,
+		},
+		{
+			name: "mark as used error",
+			prepare: func(t *testing.T, s *RefreshTokenService, store *mockStore, token string) string {
+				store.markErr = errors.New("deadlock detected")
+				return token
+			},
+			userAgent:  "agent",
+			wantErrMsg: "deadlock detected",
+			wantReason: metrics.RefreshFailureDBError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newMockStore()
+			s := newTestService(t, store, now)
+
+			token, err := s.Issue(context.Background(), "user-id", "agent", "127.0.0.1")
+			require.NoError(t, err)
+			if tt.prepare != nil {
+				token = tt.prepare(t, s, store, token)
+			}
+
+			refreshed := testutil.ToFloat64(metrics.TokensRefreshed)
+			failures := 0.0
+			if tt.wantReason != "" {
+				failures = testutil.ToFloat64(metrics.RefreshFailures.WithLabelValues(tt.wantReason))
+			}
+
+			newToken, userID, err := s.Refresh(context.Background(), token, tt.userAgent, "127.0.0.2")
+			assert.Equal(t, tt.wantDeleted, store.deleted)
+
+			if tt.wantErr != nil || tt.wantErrMsg != "" {
+				require.Error(t, err)
+				if tt.wantErr != nil {
+					assert.ErrorIs(t, err, tt.wantErr)
+				}
+				assert.Contains(t, err.Error(), tt.wantErrMsg)
+				assert.Empty(t, newToken)
+				assert.Len(t, store.tokens, 1, "no token is issued")
+				assert.Equal(t, failures+1, testutil.ToFloat64(metrics.RefreshFailures.WithLabelValues(tt.wantReason)))
+				assert.Equal(t, refreshed, testutil.ToFloat64(metrics.TokensRefreshed))
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "user-id", userID)
+			assert.Equal(t, refreshed+1, testutil.ToFloat64(metrics.TokensRefreshed))
+			assert.True(t, store.tokens[s.hasher.Lookup(token)].IsUsed)
+			assert.Equal(t, "127.0.0.2", store.tokens[s.hasher.Lookup(newToken)].IPAddress)
+
+			_, _, err = s.Refresh(context.Background(), token, tt.userAgent, "127.0.0.2")
+			assert.ErrorIs(t, err, ErrInvalidToken, "a token is exchanged only once")
+		})
+	}
+}
+
+func TestRefreshTokenService_Logout(t *testing.T) {
+	store := newMockStore()
+	s := newTestService(t, store, time.Now())
+
+	logouts := testutil.ToFloat64(metrics.Logouts)
+	require.NoError(t, s.Logout(context.Background(), "user-id"))
+	assert.Equal(t, []string{"user-id"}, store.deleted)
+	assert.Equal(t, logouts+1, testutil.ToFloat64(metrics.Logouts))
+
+	store.deleteErr = errors.New("connection refused")
+	assert.EqualError(t, s.Logout(context.Background(), "user-id"), "connection refused")
+	assert.Equal(t, logouts+1, testutil.ToFloat64(metrics.Logouts))
+}
@@ -0,0 +1,198 @@
+package tokenhash
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/AtoyanMikhail/auth/internal/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithms of the stored hashes
+const (
+	AlgorithmSHA256   = "sha256"
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+var (
+	// ErrMismatch is returned by Verify if the token doesn't match the hash
+	ErrMismatch = errors.New("token does not match the hash")
+	// ErrUnknownFormat is returned by Verify if the hash was not produced by a Hasher
+	ErrUnknownFormat = errors.New("unknown token hash format")
+)
+
+// Hasher hashes refresh tokens for storage. Every token gets two hashes:
+//   - the lookup hash, an HMAC-SHA256 of the token keyed with the pepper, deterministic so that the token can be
+//     found by it;
+//   - the stored hash, verifying the token, produced by the configured algorithm from the lookup hash, so that
+//     the pepper protects it as well. It is encoded with its algorithm and parameters: "$sha256$<hex>",
+//     bcrypt's "$2a$<cost>$..." or "$argon2id$v=19$m=<KiB>,t=<iterations>,p=<parallelism>$<salt>$<hash>".
+type Hasher struct {
+	pepper []byte
+	cfg    config.TokenHashConfig
+}
+
+// New creates a hasher configured by cfg
+func New(cfg config.TokenHashConfig) (*Hasher, error) {
+	if cfg.Pepper == "" {
+		return nil, errors.New("token hash pepper is empty")
+	}
+
+	switch cfg.Algorithm {
+	case AlgorithmSHA256:
+	case AlgorithmArgon2id:
+		p := argon2Params{memory: cfg.Argon2MemoryKiB, iterations: cfg.Argon2Iterations, parallelism: cfg.Argon2Parallelism}
+		if err := p.validate(); err != nil {
+			return nil, err
+		}
+	case AlgorithmBcrypt:
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("invalid bcrypt cost: %d", cfg.BcryptCost)
+		}
+	default:
+		return nil, fmt.Errorf("unknown token hash algorithm: %q", cfg.Algorithm)
+	}
+
+	return &Hasher{pepper: []byte(cfg.Pepper), cfg: cfg}, nil
+}
+
+// Lookup returns the hex encoded lookup hash of token
+func (h *Hasher) Lookup(token string) string {
+	mac := hmac.New(sha256.New, h.pepper)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Hash returns the stored hash of token with the configured algorithm
+func (h *Hasher) Hash(token string) (string, error) {
+	lookup := h.Lookup(token)
+
+	switch h.cfg.Algorithm {
+	case AlgorithmBcrypt:
+		// The lookup hash is 64 bytes long, below the 72 bytes bcrypt truncates its input to
+		hash, err := bcrypt.GenerateFromPassword([]byte(lookup), h.cfg.BcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("failed to hash token: %w", err)
+		}
+		return string(hash), nil
+	case AlgorithmArgon2id:
+		salt := make([]byte, argon2SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", fmt.Errorf("failed to generate salt: %w", err)
+		}
+		p := argon2Params{memory: h.cfg.Argon2MemoryKiB, iterations: h.cfg.Argon2Iterations, parallelism: h.cfg.Argon2Parallelism}
+		return p.encode(salt, p.key(lookup, salt, argon2KeyLength)), nil
+	default:
+		return "$" + AlgorithmSHA256 + "$" + lookup, nil
+	}
+}
+
+// Verify checks token against a stored hash. needsRehash is true if the hash was produced with another
+// algorithm or other parameters than the configured ones, in which case the caller should store Hash(token).
+func (h *Hasher) Verify(token, encoded string) (needsRehash bool, err error) {
+	lookup := h.Lookup(token)
+
+	switch {
+	case strings.HasPrefix(encoded, "$"+AlgorithmSHA256+"$"):
+		stored := strings.TrimPrefix(encoded, "$"+AlgorithmSHA256+"$")
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(lookup)) != 1 {
+			return false, ErrMismatch
+		}
+		return h.cfg.Algorithm != AlgorithmSHA256, nil
+
+	case strings.HasPrefix(encoded, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(lookup))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, ErrMismatch
+		}
+		if err != nil {
+			return false, fmt.Errorf("%w: %s", ErrUnknownFormat, err.Error())
+		}
+		cost, _ := bcrypt.Cost([]byte(encoded))
+		return h.cfg.Algorithm != AlgorithmBcrypt || cost != h.cfg.BcryptCost, nil
+
+	case strings.HasPrefix(encoded, "$"+AlgorithmArgon2id+"$"):
+		p, salt, key, err := decodeArgon2(encoded)
+		if err != nil {
+			return false, err
+		}
+		if subtle.ConstantTimeCompare(p.key(lookup, salt, uint32(len(key))), key) != 1 {
+			return false, ErrMismatch
+		}
+		current := argon2Params{memory: h.cfg.Argon2MemoryKiB, iterations: h.cfg.Argon2Iterations, parallelism: h.cfg.Argon2Parallelism}
+		return h.cfg.Algorithm != AlgorithmArgon2id || p != current, nil
+
+	default:
+		return false, ErrUnknownFormat
+	}
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+// validate rejects the parameters argon2.IDKey panics on, and the memory it silently raises
+func (p argon2Params) validate() error {
+	if p.memory == 0 || p.iterations == 0 || p.parallelism == 0 {
+		return fmt.Errorf("invalid argon2 parameters: m=%d,t=%d,p=%d, all must be positive", p.memory, p.iterations, p.parallelism)
+	}
+	return nil
+}
+
+func (p argon2Params) key(lookup string, salt []byte, length uint32) []byte {
+	return argon2.IDKey([]byte(lookup), salt, p.iterations, p.memory, p.parallelism, length)
+}
+
+func (p argon2Params) encode(salt, key []byte) string {
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		AlgorithmArgon2id, argon2.Version, p.memory, p.iterations, p.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func decodeArgon2(encoded string) (argon2Params, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=65536,t=1,p=4", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return argon2Params{}, nil, nil, ErrUnknownFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2Params{}, nil, nil, fmt.Errorf("%w: unsupported argon2 version %q", ErrUnknownFormat, parts[2])
+	}
+
+	var p argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism); err != nil {
+		return argon2Params{}, nil, nil, fmt.Errorf("%w: invalid argon2 parameters %q", ErrUnknownFormat, parts[3])
+	}
+	if err := p.validate(); err != nil {
+		return argon2Params{}, nil, nil, fmt.Errorf("%w: %s", ErrUnknownFormat, err.Error())
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return argon2Params{}, nil, nil, fmt.Errorf("%w: invalid argon2 salt", ErrUnknownFormat)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return argon2Params{}, nil, nil, fmt.Errorf("%w: invalid argon2 hash", ErrUnknownFormat)
+	}
+
+	return p, salt, key, nil
+}
@@ -0,0 +1,211 @@
+package tokenhash
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AtoyanMikhail/auth/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig(algorithm string) config.TokenHashConfig {
+	return config.TokenHashConfig{
+		Pepper:            "test-pepper-test-pepper-test-pepper",
+		Algorithm:         algorithm,
+		BcryptCost:        4,
+		Argon2MemoryKiB:   1024,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(cfg *config.TokenHashConfig)
+		wantErr string
+	}{
+		{name: "valid"},
+		{
+			name:    "empty pepper",
+			modify:  func(cfg *config.TokenHashConfig) { cfg.Pepper = "" },
+			wantErr: "pepper is empty",
+		},
+		{
+			name:    "unknown algorithm",
+			modify:  func(cfg *config.TokenHashConfig) { cfg.Algorithm = "md5" },
+			wantErr: "unknown token hash algorithm",
+		},
+		{
+			name: "invalid bcrypt cost",
+			modify: func(cfg *config.TokenHashConfig) {
+				cfg.Algorithm = AlgorithmBcrypt
+				cfg.BcryptCost = 100
+			},
+			wantErr: "invalid bcrypt cost",
+		},
+		{
+			name: "zero argon2 iterations",
+			modify: func(cfg *config.TokenHashConfig) {
+				cfg.Algorithm = AlgorithmArgon2id
+				cfg.Argon2Iterations = 0
+			},
+			wantErr: "invalid argon2 parameters",
+		},
+		{
+			name: "zero argon2 parallelism",
+			modify: func(cfg *config.TokenHashConfig) {
+				cfg.Algorithm = AlgorithmArgon2id
+				cfg.Argon2Parallelism = 0
+			},
+			wantErr: "invalid argon2 parameters",
+		},
+		{
+			name: "zero argon2 memory",
+			modify: func(cfg *config.TokenHashConfig) {
+				cfg.Algorithm = AlgorithmArgon2id
+				cfg.Argon2MemoryKiB = 0
+			},
+			wantErr: "invalid argon2 parameters",
+		},
+		{
+			name: "argon2 parameters ignored by other algorithms",
+			modify: func(cfg *config.TokenHashConfig) {
+				cfg.Argon2Iterations = 0
+				cfg.Argon2Parallelism = 0
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(AlgorithmSHA256)
+			if tt.modify != nil {
+				tt.modify(&cfg)
+			}
+
+			_, err := New(cfg)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestHasher_Lookup(t *testing.T) {
+	h, err := New(testConfig(AlgorithmSHA256))
+	require.NoError(t, err)
+
+	other := testConfig(AlgorithmSHA256)
+	other.Pepper = "another-pepper-another-pepper-another"
+	h2, err := New(other)
+	require.NoError(t, err)
+
+	lookup := h.Lookup("token")
+	assert.Len(t, lookup, 64)
+	assert.Equal(t, lookup, h.Lookup("token"))
+	assert.NotEqual(t, lookup, h.Lookup("other-token"))
+	assert.NotEqual(t, lookup, h2.Lookup("token"))
+}
+
+func TestHasher_HashVerify(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmSHA256, AlgorithmBcrypt, AlgorithmArgon2id} {
+		t.Run(algorithm, func(t *testing.T) {
+			h, err := New(testConfig(algorithm))
+			require.NoError(t, err)
+
+			encoded, err := h.Hash("token")
+			require.NoError(t, err)
+			assert.NotContains(t, encoded, "token")
+
+			needsRehash, err := h.Verify("token", encoded)
+			assert.NoError(t, err)
+			assert.False(t, needsRehash)
+
+			_, err = h.Verify("other-token", encoded)
+			assert.ErrorIs(t, err, ErrMismatch)
+		})
+	}
+}
+
+func TestHasher_Verify_NeedsRehash(t *testing.T) {
+	tests := []struct {
+		name   string
+		from   config.TokenHashConfig
+		to     config.TokenHashConfig
+		rehash bool
+	}{
+		{
+			name:   "sha256 to argon2id",
+			from:   testConfig(AlgorithmSHA256),
+			to:     testConfig(AlgorithmArgon2id),
+			rehash: true,
+		},
+		{
+			name: "bcrypt cost raised",
+			from: testConfig(AlgorithmBcrypt),
+			to: func() config.TokenHashConfig {
+				cfg := testConfig(AlgorithmBcrypt)
+				cfg.BcryptCost = 5
+				return cfg
+			}(),
+			rehash: true,
+		},
+		{
+			name: "argon2id memory raised",
+			from: testConfig(AlgorithmArgon2id),
+			to: func() config.TokenHashConfig {
+				cfg := testConfig(AlgorithmArgon2id)
+				cfg.Argon2MemoryKiB = 2048
+				return cfg
+			}(),
+			rehash: true,
+		},
+		{
+			name:   "argon2id unchanged",
+			from:   testConfig(AlgorithmArgon2id),
+			to:     testConfig(AlgorithmArgon2id),
+			rehash: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, err := New(tt.from)
+			require.NoError(t, err)
+			to, err := New(tt.to)
+			require.NoError(t, err)
+
+			encoded, err := from.Hash("token")
+			require.NoError(t, err)
+
+			needsRehash, err := to.Verify("token", encoded)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.rehash, needsRehash)
+		})
+	}
+}
+
+func TestHasher_Verify_InvalidFormat(t *testing.T) {
+	h, err := New(testConfig(AlgorithmSHA256))
+	require.NoError(t, err)
+
+	for _, encoded := range []string{
+		"",
+		"plain",
+		"$md5$abc",
+		"$argon2id$v=19$m=1024,t=1,p=1$salt",
+		"$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$bad$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=1024,t=0,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=1024,t=1,p=0$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=0,t=1,p=1$c2FsdA$aGFzaA",
+		"$2a$04$" + strings.Repeat("x", 10),
+	} {
+		_, err := h.Verify("token", encoded)
+		assert.ErrorIs(t, err, ErrUnknownFormat, encoded)
+	}
+}
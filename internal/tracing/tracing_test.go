@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/AtoyanMikhail/auth/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Test helper installing a global provider recording the ended spans
+func newRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func TestStartQuery(t *testing.T) {
+	recorder := newRecorder(t)
+
+	ctx, span := StartQuery(context.Background(), "get_by_id", `
+		SELECT id, user_id
+		FROM refresh_tokens
+		WHERE id = $1`)
+	assert.NotEmpty(t, TraceID(ctx))
+	RecordError(span, errors.New("connection reset"))
+	span.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	got := spans[0]
+
+	assert.Equal(t, "postgres.get_by_id", got.Name())
+	assert.Equal(t, trace.SpanKindClient, got.SpanKind())
+	assert.Equal(t, TracerName, got.InstrumentationScope().Name)
+	assert.ElementsMatch(t, []attribute.KeyValue{
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation.name", "get_by_id"),
+		attribute.String("db.query.text", "SELECT id, user_id FROM refresh_tokens WHERE id = $1"),
+	}, got.Attributes())
+	assert.Equal(t, codes.Error, got.Status().Code)
+	assert.Equal(t, "connection reset", got.Status().Description)
+	require.Len(t, got.Events(), 1)
+	assert.Equal(t, "exception", got.Events()[0].Name)
+}
+
+func TestTraceID(t *testing.T) {
+	assert.Empty(t, TraceID(context.Background()))
+
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+	ctx := trace.ContextWithSpanContext(context.Background(),
+		trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", TraceID(ctx))
+}
+
+func TestSetup_Disabled(t *testing.T) {
+	previous := otel.GetTracerProvider()
+
+	shutdown, err := Setup(context.Background(), config.TracingConfig{Enabled: false})
+	require.NoError(t, err)
+
+	assert.Equal(t, previous, otel.GetTracerProvider(), "the provider is kept")
+	assert.NotNil(t, otel.GetTextMapPropagator())
+	assert.NoError(t, shutdown(context.Background()))
+}
+
+func TestSetup_UnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), config.TracingConfig{Enabled: true, Exporter: "zipkin", SampleRatio: 1})
+	assert.ErrorContains(t, err, "unknown trace exporter")
+}
@@ -0,0 +1,2 @@
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE IF EXISTS refresh_tokens RENAME TO jwt;
@@ -0,0 +1,3 @@
+-- The repository has always used refresh_tokens with an updated_at column, which 000001 did not create
+ALTER TABLE IF EXISTS jwt RENAME TO refresh_tokens;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT NOW();
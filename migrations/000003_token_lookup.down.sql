@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS refresh_tokens_lookup_hash_idx;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS lookup_hash;
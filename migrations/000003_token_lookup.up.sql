@@ -0,0 +1,3 @@
+-- lookup_hash is the peppered SHA-256 of the token, so that a refresh finds its token without scanning the user's tokens
+ALTER TABLE refresh_tokens ADD COLUMN lookup_hash CHAR(64);
+CREATE UNIQUE INDEX refresh_tokens_lookup_hash_idx ON refresh_tokens (lookup_hash);
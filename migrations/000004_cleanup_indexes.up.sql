@@ -0,0 +1,3 @@
+-- The cleanup job deletes expired and used tokens in batches, these indexes keep each batch from scanning the table
+CREATE INDEX IF NOT EXISTS refresh_tokens_expires_at_idx ON refresh_tokens (expires_at);
+CREATE INDEX IF NOT EXISTS refresh_tokens_used_updated_at_idx ON refresh_tokens (updated_at) WHERE is_used;